@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+	"gopkg.in/yaml.v2"
+)
+
+// batchScopesConfig is the file given with token batch --scopes.
+type batchScopesConfig struct {
+	Scopes map[string]keystoneScope `yaml:"scopes"`
+}
+
+type batchOptions struct {
+	scopesFile  string
+	projects    []string
+	concurrency int
+}
+
+// batchResult is the entry of a scope in the output of token batch.
+type batchResult struct {
+	TokenID         string                 `json:"token_id,omitempty"`
+	ExpiresAt       *time.Time             `json:"expires_at,omitempty"`
+	ProjectID       string                 `json:"project_id,omitempty"`
+	ProjectDomainID string                 `json:"project_domain_id,omitempty"`
+	DomainID        string                 `json:"domain_id,omitempty"`
+	Error           map[string]interface{} `json:"error,omitempty"`
+}
+
+// batchCommand authenticates once and rescopes the token to every requested scope
+// with a bounded number of concurrent requests. Failures are reported per scope; the
+// command fails after printing all results if any scope failed.
+func batchCommand(opts batchOptions, a *tokentool.Authenticator) error {
+	scopes, err := opts.Scopes(a)
+	if err != nil {
+		return err
+	}
+	if len(scopes) == 0 {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("usage: token batch --scopes FILE | --project NAME..."))
+	}
+	if opts.concurrency < 1 {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("--concurrency must be at least 1"))
+	}
+
+	token, err := a.Authenticate()
+	if err != nil {
+		return err
+	}
+
+	names := make(chan string)
+	results := make(map[string]batchResult, len(scopes))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < opts.concurrency && i < len(scopes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				result := rescopeBatchToken(token, scopes[name], a)
+				mutex.Lock()
+				results[name] = result
+				mutex.Unlock()
+			}
+		}()
+	}
+	for name := range scopes {
+		names <- name
+	}
+	close(names)
+	wg.Wait()
+
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	if err := e.Encode(results); err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Error != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to issue tokens for %d of %d scopes", failed, len(scopes))
+	}
+	return nil
+}
+
+func rescopeBatchToken(token *tokentool.Token, scope keystoneScope, a *tokentool.Authenticator) batchResult {
+	scoped, err := a.Rescope(token, scope.AuthScope())
+	if err != nil {
+		return batchResult{Error: errorReport(err)}
+	}
+	expiresAt := scoped.ExpiresAt.UTC()
+	result := batchResult{TokenID: scoped.ID, ExpiresAt: &expiresAt}
+	if project, err := scoped.Result.ExtractProject(); err == nil && project != nil {
+		result.ProjectID = project.ID
+		result.ProjectDomainID = project.Domain.ID
+	}
+	if domain, err := scoped.Result.ExtractDomain(); err == nil && domain != nil {
+		result.DomainID = domain.ID
+	}
+	return result
+}
+
+// Scopes returns the scopes of the --scopes file and the --project flags by name.
+// Projects given by name without domain are looked up in the project domain of the
+// configured scope, or the user domain if there is none.
+func (o batchOptions) Scopes(a *tokentool.Authenticator) (map[string]keystoneScope, error) {
+	domain := keystoneScope{ProjectDomainID: a.AuthOptions.DomainID, ProjectDomainName: a.AuthOptions.DomainName}
+	if scope := a.AuthOptions.Scope; scope != nil && (scope.ProjectID != "" || scope.ProjectName != "") {
+		domain = keystoneScope{ProjectDomainID: scope.DomainID, ProjectDomainName: scope.DomainName}
+	}
+
+	scopes := map[string]keystoneScope{}
+	if o.scopesFile != "" {
+		data, err := os.ReadFile(o.scopesFile)
+		if err != nil {
+			return nil, tokentool.WithKind(tokentool.KindConfiguration, err)
+		}
+		var config batchScopesConfig
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("failed to parse %s: %w", o.scopesFile, err))
+		}
+		for name, scope := range config.Scopes {
+			if scope.ProjectName != "" && scope.ProjectDomainID == "" && scope.ProjectDomainName == "" {
+				scope.ProjectDomainID, scope.ProjectDomainName = domain.ProjectDomainID, domain.ProjectDomainName
+			}
+			scopes[name] = scope
+		}
+	}
+
+	for _, name := range o.projects {
+		if _, exists := scopes[name]; exists {
+			return nil, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("scope %q is given more than once", name))
+		}
+		scope := domain
+		scope.ProjectName = name
+		scopes[name] = scope
+	}
+	return scopes, nil
+}
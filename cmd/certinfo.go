@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+func certInfoCommand(transport tokentool.Transport) error {
+	if !transport.HasClientCert() {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("no client certificate configured, use --cert or $OS_CERT"))
+	}
+	cert, err := tokentool.LoadClientCertificate(transport.Cert, transport.Key, transport.CertPassphrase)
+	if err != nil {
+		return err
+	}
+	leaf := cert.Leaf
+
+	var sans []string
+	sans = append(sans, leaf.DNSNames...)
+	sans = append(sans, leaf.EmailAddresses...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range leaf.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	var validity string
+	now := time.Now()
+	switch {
+	case now.After(leaf.NotAfter):
+		validity = "EXPIRED"
+	case now.Before(leaf.NotBefore):
+		validity = "NOT YET VALID"
+	default:
+		validity = fmt.Sprintf("valid, expires in %s", leaf.NotAfter.Sub(now).Round(time.Minute))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "File:\t%s\n", transport.Cert)
+	fmt.Fprintf(w, "Subject:\t%s\n", leaf.Subject)
+	fmt.Fprintf(w, "Issuer:\t%s\n", leaf.Issuer)
+	fmt.Fprintf(w, "SANs:\t%s\n", strings.Join(sans, ", "))
+	fmt.Fprintf(w, "Serial:\t%s\n", formatSerial(leaf))
+	fmt.Fprintf(w, "Key type:\t%s\n", keyType(leaf))
+	fmt.Fprintf(w, "Not before:\t%s\n", leaf.NotBefore.Local().Format(time.RFC1123))
+	fmt.Fprintf(w, "Not after:\t%s\n", leaf.NotAfter.Local().Format(time.RFC1123))
+	fmt.Fprintf(w, "Status:\t%s\n", validity)
+	fmt.Fprintf(w, "Chain:\t%d intermediate certificate(s)\n", len(cert.Certificate)-1)
+	return w.Flush()
+}
+
+func formatSerial(cert *x509.Certificate) string {
+	hex := fmt.Sprintf("%X", cert.SerialNumber)
+	if len(hex)%2 == 1 {
+		hex = "0" + hex
+	}
+	parts := make([]string, 0, len(hex)/2)
+	for i := 0; i < len(hex); i += 2 {
+		parts = append(parts, hex[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+func keyType(cert *x509.Certificate) string {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bit", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/gophercloud/utils/env"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+	"gopkg.in/yaml.v2"
+)
+
+// legacyMicroversionHeaders lists the service specific microversion headers that
+// are sent in addition to the generic OpenStack-API-Version header.
+var legacyMicroversionHeaders = map[string]string{
+	"compute":            "X-OpenStack-Nova-API-Version",
+	"baremetal":          "X-OpenStack-Ironic-API-Version",
+	"shared-file-system": "X-OpenStack-Manila-API-Version",
+	"sharev2":            "X-OpenStack-Manila-API-Version",
+}
+
+type curlOptions struct {
+	discoverVersions bool
+	microversions    []string
+	noContentType    bool
+	region           string
+	iface            string
+}
+
+func curlCommand(curlArgs []string, opts curlOptions, a *tokentool.Authenticator) error {
+	curlPath, err := exec.LookPath("curl")
+	if err != nil {
+		return tokentool.WithKind(tokentool.KindMissingDependency, fmt.Errorf("curl command not found in path: %w", err))
+	}
+
+	microversions, err := cloudsYAMLMicroversions()
+	if err != nil {
+		return err
+	}
+	for _, mv := range opts.microversions {
+		service, version, ok := strings.Cut(mv, "=")
+		if !ok || service == "" || version == "" {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("invalid microversion %q, expected <service-type>=<version>", mv))
+		}
+		microversions[service] = version
+	}
+
+	token, err := a.Authenticate()
+	if err != nil {
+		return err
+	}
+
+	catalog, err := token.Result.ExtractServiceCatalog()
+	if err != nil {
+		return fmt.Errorf("failed to get catalog from auth response: %s", err)
+	}
+
+	vars := tokentool.CatalogVars(catalog, opts.region)
+	if opts.discoverVersions {
+		tokentool.DiscoverVersionVars(token.ProviderClient, catalog, tokentool.VersionDiscoveryOpts{
+			Region:    opts.region,
+			Interface: opts.iface,
+		}, vars)
+	}
+	for i, arg := range curlArgs {
+		curlArgs[i] = os.Expand(arg, func(s string) string { return vars[s] })
+	}
+
+	requestID, err := newRequestID()
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"X-Auth-Token: " + token.ID}
+	if !opts.noContentType {
+		headers = append(headers, "Content-Type: application/json")
+	}
+	headers = append(headers, microversionHeaders(microversions)...)
+	headers = append(headers, "X-Openstack-Request-Id: "+requestID)
+
+	log.Println("request id:", requestID)
+	log.Println("curl", strings.Join(curlArgs, " "))
+
+	//the headers are passed to curl as a config file on an inherited file descriptor,
+	//so that the token does not show up in the process listing
+	configFD, err := secretPipe(curlConfig(headers))
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(curlPath, curlArgv(curlPath, configFD, append(a.Transport.CurlArgs(), curlArgs...)), os.Environ())
+}
+
+// curlArgv returns the argv of the curl process, reading its headers from the config
+// file available on configFD. No secrets are ever part of the returned slice.
+func curlArgv(curlPath string, configFD int, curlArgs []string) []string {
+	return append([]string{curlPath, "--config", fmt.Sprintf("/dev/fd/%d", configFD)}, curlArgs...)
+}
+
+// curlConfig renders the given headers in the curl config file format.
+func curlConfig(headers []string) string {
+	var b strings.Builder
+	for _, h := range headers {
+		b.WriteString("header = ")
+		b.WriteString(curlConfigQuote(h))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func curlConfigQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// microversionHeaders returns the headers requesting the given microversions,
+// keyed by service type.
+func microversionHeaders(microversions map[string]string) []string {
+	services := make([]string, 0, len(microversions))
+	for service := range microversions {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var headers []string
+	for _, service := range services {
+		version := microversions[service]
+		headers = append(headers, fmt.Sprintf("OpenStack-API-Version: %s %s", service, version))
+		if legacy, ok := legacyMicroversionHeaders[service]; ok {
+			headers = append(headers, fmt.Sprintf("%s: %s", legacy, version))
+		}
+	}
+	return headers
+}
+
+// cloudsYAMLMicroversions reads the <service>_api_version keys of the cloud selected
+// with OS_CLOUD from clouds.yaml. Only values of the form major.minor are considered
+// to be microversions, plain major versions like identity_api_version: 3 are ignored.
+func cloudsYAMLMicroversions() (map[string]string, error) {
+	microversions := map[string]string{}
+	cloudName := env.Getenv("OS_CLOUD")
+	if cloudName == "" {
+		return microversions, nil
+	}
+	path, content, err := clientconfig.FindAndReadCloudsYAML()
+	if err != nil || path == "" {
+		return microversions, nil
+	}
+
+	var clouds struct {
+		Clouds map[string]map[string]yamlScalar `yaml:"clouds"`
+	}
+	if err := yaml.Unmarshal(content, &clouds); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for key, value := range clouds.Clouds[cloudName] {
+		if !strings.HasSuffix(key, "_api_version") || !strings.Contains(string(value), ".") {
+			continue
+		}
+		service := strings.ReplaceAll(strings.TrimSuffix(key, "_api_version"), "_", "-")
+		microversions[service] = string(value)
+	}
+	return microversions, nil
+}
+
+// yamlScalar holds the literal text of a YAML scalar, so that a version like 2.10 is
+// not turned into the float 2.1. Non-scalar values are ignored.
+type yamlScalar string
+
+func (s *yamlScalar) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err == nil {
+		*s = yamlScalar(v)
+	}
+	return nil
+}
+
+// newRequestID generates a random ID in the format used by OpenStack services for
+// their X-Openstack-Request-Id header.
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate request id: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("req-%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
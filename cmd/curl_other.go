@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+// secretPipe is not available on platforms without /dev/fd, so token curl cannot
+// hand the token to curl without exposing it in the process listing.
+func secretPipe(content string) (int, error) {
+	return 0, tokentool.WithKind(tokentool.KindConfiguration, errors.New("token curl is not supported on this platform"))
+}
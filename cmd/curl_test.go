@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testToken = "gAAAAABsecret-token"
+
+func TestCurlConfigQuote(t *testing.T) {
+	cases := map[string]string{
+		`plain`:              `"plain"`,
+		`say "hi"`:           `"say \"hi\""`,
+		`back\slash`:         `"back\\slash"`,
+		"line\nbreak":        `"line\nbreak"`,
+		"carriage\r\ttab":    `"carriage\r\ttab"`,
+		"X-Auth-Token: \"\n": `"X-Auth-Token: \"\n"`,
+	}
+	for input, expected := range cases {
+		if actual := curlConfigQuote(input); actual != expected {
+			t.Errorf("curlConfigQuote(%q) = %s, expected %s", input, actual, expected)
+		}
+	}
+
+	config := curlConfig([]string{"A: 1", "B: \"2\"\nheader = \"injected\""})
+	expected := "header = \"A: 1\"\nheader = \"B: \\\"2\\\"\\nheader = \\\"injected\\\"\"\n"
+	if config != expected {
+		t.Errorf("curlConfig = %q, expected %q", config, expected)
+	}
+	if lines := strings.Count(config, "\n"); lines != 2 {
+		t.Errorf("a header value must not add config lines, got %d lines", lines)
+	}
+}
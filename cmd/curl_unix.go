@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// secretPipe writes content into a new pipe and returns the file descriptor of its
+// read end. The descriptor is inherited by processes started with syscall.Exec,
+// which allows handing secrets to a child process without putting them into its
+// argv or environment. content must fit into the pipe buffer (64KiB on Linux).
+func secretPipe(content string) (int, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	defer w.Close()
+	if _, err := w.WriteString(content); err != nil {
+		r.Close()
+		return 0, fmt.Errorf("failed to write to pipe: %w", err)
+	}
+	//os.Pipe sets close-on-exec, a duplicate of the descriptor does not have it
+	fd, err := syscall.Dup(int(r.Fd()))
+	r.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to duplicate pipe: %w", err)
+	}
+	return fd, nil
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCurlArgvDoesNotContainToken(t *testing.T) {
+	headers := []string{"X-Auth-Token: " + testToken, "Content-Type: application/json"}
+	fd, err := secretPipe(curlConfig(headers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.NewFile(uintptr(fd), "config").Close()
+
+	argv := curlArgv("/usr/bin/curl", fd, []string{"-s", "https://example.com/servers"})
+	for _, arg := range argv {
+		if strings.Contains(arg, testToken) {
+			t.Errorf("argv contains the token: %q", argv)
+		}
+	}
+	if len(argv) < 3 || argv[1] != "--config" || !strings.HasPrefix(argv[2], "/dev/fd/") {
+		t.Errorf("argv does not read the config from a file descriptor: %q", argv)
+	}
+	if argv[len(argv)-1] != "https://example.com/servers" {
+		t.Errorf("curl arguments are not passed on: %q", argv)
+	}
+}
+
+func TestSecretPipeContent(t *testing.T) {
+	content := curlConfig([]string{"X-Auth-Token: " + testToken})
+	fd, err := secretPipe(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fd), "config")
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("read %q from the pipe, expected %q", data, content)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+	"gopkg.in/yaml.v2"
+)
+
+// dockerCredentialsNotFound is the message the docker CLI expects from credential
+// helpers when they have no credentials for a registry.
+const dockerCredentialsNotFound = "credentials not found in native keychain"
+
+type dockerCredentialsConfig struct {
+	Registries map[string]keystoneScope `yaml:"registries"`
+}
+
+type dockerCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// dockerCredentialCommand implements the docker credential helper protocol. Secrets
+// given to "store" are discarded: the registry is only mapped to the currently
+// configured keystone scope, and "get" issues a fresh token for that scope. Only
+// registries added explicitly with "add" are accepted by "store", so that a helper
+// configured too broadly never swallows the credentials of other registries.
+func dockerCredentialCommand(args []string, authInfo *clientconfig.AuthInfo, a *tokentool.Authenticator) error {
+	if len(args) > 0 && args[0] == "add" {
+		if len(args) != 2 {
+			return tokentool.WithKind(tokentool.KindConfiguration, errors.New("usage: token docker-credential add REGISTRY"))
+		}
+		return addDockerRegistry(args[1], authInfo)
+	}
+	action := ""
+	if len(args) > 0 {
+		action = args[0]
+	}
+	err := runDockerCredentialAction(action, os.Stdin, os.Stdout, authInfo, a)
+	if err != nil {
+		//the docker CLI reads error messages from stdout
+		fmt.Println(err)
+	}
+	return err
+}
+
+func runDockerCredentialAction(action string, in io.Reader, out io.Writer, authInfo *clientconfig.AuthInfo, a *tokentool.Authenticator) error {
+	path, err := dockerCredentialsConfigPath()
+	if err != nil {
+		return err
+	}
+	config, err := readDockerCredentialsConfig(path)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "get":
+		serverURL, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		registry := normalizeRegistry(string(serverURL))
+		scope, ok := config.Registries[registry]
+		if !ok {
+			return errors.New(dockerCredentialsNotFound)
+		}
+		token, err := issueScopedToken(scope, authInfo, a)
+		if err != nil {
+			return err
+		}
+		username := scope.Username
+		if username == "" {
+			username = "token"
+		}
+		return json.NewEncoder(out).Encode(dockerCredentials{
+			ServerURL: strings.TrimSpace(string(serverURL)),
+			Username:  username,
+			Secret:    token.ID,
+		})
+
+	case "store":
+		var creds dockerCredentials
+		if err := json.NewDecoder(in).Decode(&creds); err != nil {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("invalid credentials on stdin: %w", err))
+		}
+		registry := normalizeRegistry(creds.ServerURL)
+		if _, ok := config.Registries[registry]; !ok {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf(
+				"registry %s is not handled by the token credential helper, the credentials were not stored (add it with `token docker-credential add %s` if it accepts keystone tokens)",
+				registry, registry))
+		}
+		scope, err := currentDockerScope(authInfo, creds.Username)
+		if err != nil {
+			return err
+		}
+		config.Registries[registry] = scope
+		return writeDockerCredentialsConfig(path, config)
+
+	case "erase":
+		serverURL, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		delete(config.Registries, normalizeRegistry(string(serverURL)))
+		return writeDockerCredentialsConfig(path, config)
+
+	case "list":
+		result := map[string]string{}
+		for registry, scope := range config.Registries {
+			result[registry] = scope.Username
+		}
+		return json.NewEncoder(out).Encode(result)
+
+	default:
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown credential helper action %q, expected get, store, erase or list", action))
+	}
+}
+
+// addDockerRegistry maps registry to the currently configured keystone scope, so
+// that "docker login" is accepted for it.
+func addDockerRegistry(registry string, authInfo *clientconfig.AuthInfo) error {
+	path, err := dockerCredentialsConfigPath()
+	if err != nil {
+		return err
+	}
+	config, err := readDockerCredentialsConfig(path)
+	if err != nil {
+		return err
+	}
+	registry = normalizeRegistry(registry)
+	username := ""
+	if existing, ok := config.Registries[registry]; ok {
+		username = existing.Username
+	}
+	scope, err := currentDockerScope(authInfo, username)
+	if err != nil {
+		return err
+	}
+	config.Registries[registry] = scope
+	return writeDockerCredentialsConfig(path, config)
+}
+
+// currentDockerScope returns the currently configured keystone scope.
+func currentDockerScope(authInfo *clientconfig.AuthInfo, username string) (keystoneScope, error) {
+	authOpts, err := resolveAuthOptions(authInfo)
+	if err != nil {
+		return keystoneScope{}, err
+	}
+	if authOpts.Scope == nil {
+		return keystoneScope{}, tokentool.WithKind(tokentool.KindConfiguration, errors.New("no keystone scope configured, set a project or domain to map the registry to"))
+	}
+	scope := keystoneScope{Username: username}
+	if s := authOpts.Scope; s.ProjectID != "" || s.ProjectName != "" {
+		scope.ProjectID, scope.ProjectName = s.ProjectID, s.ProjectName
+		scope.ProjectDomainID, scope.ProjectDomainName = s.DomainID, s.DomainName
+	} else {
+		scope.DomainID, scope.DomainName = s.DomainID, s.DomainName
+	}
+	return scope, nil
+}
+
+// normalizeRegistry strips the scheme and trailing slashes from a registry URL.
+func normalizeRegistry(serverURL string) string {
+	registry := strings.TrimSpace(serverURL)
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	return strings.TrimRight(registry, "/")
+}
+
+func dockerCredentialsConfigPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", tokentool.WithKind(tokentool.KindConfiguration, err)
+	}
+	return filepath.Join(configDir, "token-tool", "docker-credentials.yaml"), nil
+}
+
+func readDockerCredentialsConfig(path string) (*dockerCredentialsConfig, error) {
+	config := &dockerCredentialsConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, tokentool.WithKind(tokentool.KindConfiguration, err)
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("failed to parse %s: %w", path, err))
+	}
+	if config.Registries == nil {
+		config.Registries = map[string]keystoneScope{}
+	}
+	return config, nil
+}
+
+func writeDockerCredentialsConfig(path string, config *dockerCredentialsConfig) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
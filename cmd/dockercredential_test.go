@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+func TestDockerCredentialStoreRefusesUnknownRegistries(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("OS_CLOUD", "")
+	authInfo := &clientconfig.AuthInfo{
+		AuthURL:           "https://keystone.example.com/v3",
+		Username:          "alice",
+		UserDomainName:    "Default",
+		ProjectName:       "demo",
+		ProjectDomainName: "Default",
+	}
+	store := func(registry string) error {
+		in := strings.NewReader(`{"ServerURL": "` + registry + `", "Username": "alice", "Secret": "registry-password"}`)
+		return runDockerCredentialAction("store", in, &bytes.Buffer{}, authInfo, &tokentool.Authenticator{})
+	}
+
+	if err := store("https://index.docker.io/v1/"); err == nil || !strings.Contains(err.Error(), "not handled") {
+		t.Errorf("got %v for a registry that was not added, expected it to be refused", err)
+	}
+	path, err := dockerCredentialsConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("a refused login changed the mapping")
+	}
+
+	if err := dockerCredentialCommand([]string{"add", "https://keppel.example.com/"}, authInfo, &tokentool.Authenticator{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store("keppel.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	config, err := readDockerCredentialsConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope, ok := config.Registries["keppel.example.com"]
+	if !ok || scope.ProjectName != "demo" || scope.Username != "alice" {
+		t.Errorf("got mapping %+v, expected project demo with username alice", config.Registries)
+	}
+	if len(config.Registries) != 1 {
+		t.Errorf("unexpected registries %v", config.Registries)
+	}
+}
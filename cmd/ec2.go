@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alessio/shellescape"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2credentials"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+type ec2AuthOptions struct {
+	authType string
+	access   string
+	secret   string
+}
+
+// Credential returns the EC2 credential to authenticate with for --auth-type
+// v3ec2credential. Other auth types are left to the given credentials, like
+// v3password, or are meant for other clients, like the v3token written by
+// `token config export --token`, so they are ignored.
+func (o ec2AuthOptions) Credential() (*tokentool.EC2Credential, error) {
+	if o.authType != "v3ec2credential" {
+		return nil, nil
+	}
+	if o.access == "" || o.secret == "" {
+		return nil, tokentool.WithKind(tokentool.KindConfiguration, errors.New("--auth-type v3ec2credential requires --ec2-access-key and $AWS_SECRET_ACCESS_KEY"))
+	}
+	return &tokentool.EC2Credential{Access: o.access, Secret: o.secret}, nil
+}
+
+// ec2Session is an identity client authenticated as the user owning the EC2
+// credentials.
+type ec2Session struct {
+	client    *gophercloud.ServiceClient
+	userID    string
+	projectID string
+}
+
+func newEC2Session(a *tokentool.Authenticator) (*ec2Session, error) {
+	token, err := a.Authenticate()
+	if err != nil {
+		return nil, err
+	}
+	user, err := token.Result.ExtractUser()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user from auth response: %w", err)
+	}
+	session := &ec2Session{userID: user.ID}
+	if project, err := token.Result.ExtractProject(); err == nil && project != nil {
+		session.projectID = project.ID
+	}
+	session.client, err = openstack.NewIdentityV3(token.ProviderClient, gophercloud.EndpointOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identity client: %w", err)
+	}
+	return session, nil
+}
+
+// ec2CreateCommand creates an EC2 credential for the current project and prints it.
+func ec2CreateCommand(format string, a *tokentool.Authenticator) error {
+	if format != "env" && format != "json" {
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown format given: %s, expected env or json", format))
+	}
+	session, err := newEC2Session(a)
+	if err != nil {
+		return err
+	}
+	if session.projectID == "" {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("EC2 credentials belong to a project, configure a project scope"))
+	}
+	credential, err := ec2credentials.Create(session.client, session.userID, ec2credentials.CreateOpts{
+		TenantID: session.projectID,
+	}).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to create EC2 credential: %w", err)
+	}
+
+	if format == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(credential)
+	}
+	fmt.Printf("export AWS_ACCESS_KEY_ID=%s\n", shellescape.Quote(credential.Access))
+	fmt.Printf("export AWS_SECRET_ACCESS_KEY=%s\n", shellescape.Quote(credential.Secret))
+	return nil
+}
+
+// ec2ListCommand prints the EC2 credentials of the user. The text format leaves out
+// the secrets.
+func ec2ListCommand(format string, a *tokentool.Authenticator) error {
+	if format != "text" && format != "json" {
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown format given: %s, expected text or json", format))
+	}
+	session, err := newEC2Session(a)
+	if err != nil {
+		return err
+	}
+	page, err := ec2credentials.List(session.client, session.userID).AllPages()
+	if err != nil {
+		return fmt.Errorf("failed to list EC2 credentials: %w", err)
+	}
+	credentials, err := ec2credentials.ExtractCredentials(page)
+	if err != nil {
+		return fmt.Errorf("failed to list EC2 credentials: %w", err)
+	}
+
+	if format == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(credentials)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCESS\tPROJECT ID\tCURRENT PROJECT")
+	for _, credential := range credentials {
+		current := ""
+		if credential.TenantID == session.projectID {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", credential.Access, credential.TenantID, current)
+	}
+	return w.Flush()
+}
+
+func ec2DeleteCommand(access string, a *tokentool.Authenticator) error {
+	if access == "" {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("usage: token ec2 delete ACCESS"))
+	}
+	session, err := newEC2Session(a)
+	if err != nil {
+		return err
+	}
+	err = ec2credentials.Delete(session.client, session.userID, access).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("failed to delete EC2 credential: %w", err)
+	}
+	return nil
+}
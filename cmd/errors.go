@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+// reportError prints err in the given format on stderr and returns the exit code.
+func reportError(err error, format string) int {
+	kind := tokentool.ClassifyError(err)
+	if format != "json" {
+		log.Println(err)
+		return kind.ExitCode()
+	}
+
+	e := json.NewEncoder(os.Stderr)
+	e.SetIndent("", "  ")
+	if err := e.Encode(map[string]interface{}{"error": errorReport(err)}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return kind.ExitCode()
+}
+
+// errorReport describes err as JSON object with its kind, exit code and, for
+// unexpected HTTP responses, the status and message of the server.
+func errorReport(err error) map[string]interface{} {
+	kind := tokentool.ClassifyError(err)
+	report := map[string]interface{}{
+		"kind":      kind.String(),
+		"exit_code": kind.ExitCode(),
+		"message":   err.Error(),
+	}
+	if resp, ok := tokentool.UnexpectedResponse(err); ok {
+		report["http_status"] = resp.Actual
+		report["url"] = resp.URL
+		report["server_message"] = tokentool.KeystoneErrorMessage(resp.Body)
+	}
+	return report
+}
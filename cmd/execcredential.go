@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+// execCredentialMinValidity is the minimum remaining validity of reused cached
+// credentials.
+const execCredentialMinValidity = 5 * time.Minute
+
+// execCredentialCommand prints the token as ExecCredential for kubectl. Issued
+// credentials are cached, so that kubectl does not trigger an authentication on
+// every call.
+func execCredentialCommand(a *tokentool.Authenticator) error {
+	formatter := tokentool.ExecCredentialFormatter{}
+	interactive := false
+	if info := os.Getenv("KUBERNETES_EXEC_INFO"); info != "" {
+		var request tokentool.ExecCredential
+		if err := json.Unmarshal([]byte(info), &request); err != nil {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("failed to parse KUBERNETES_EXEC_INFO: %w", err))
+		}
+		formatter.APIVersion = request.APIVersion
+		interactive = request.Spec != nil && request.Spec.Interactive
+	}
+
+	cachePath, err := execCredentialCachePath(a)
+	if err != nil {
+		log.Printf("WARNING: cannot cache credentials: %s", err)
+	}
+	if cachePath != "" {
+		if status, err := readCachedExecCredential(cachePath); err == nil {
+			return formatter.Format(os.Stdout, &tokentool.Token{ID: status.Token, ExpiresAt: status.ExpirationTimestamp})
+		}
+	}
+
+	if !interactive {
+		a = nonInteractive(a)
+	}
+	token, err := a.Authenticate()
+	if err != nil {
+		return err
+	}
+	if cachePath != "" {
+		status := tokentool.ExecCredentialStatus{
+			Token:               token.ID,
+			ExpirationTimestamp: token.ExpiresAt.UTC(),
+		}
+		if err := writeCachedExecCredential(cachePath, status); err != nil {
+			log.Printf("WARNING: failed to cache credentials: %s", err)
+		}
+	}
+	return formatter.Format(os.Stdout, token)
+}
+
+// execCredentialCachePath returns the cache file for the identity and scope a
+// authenticates with.
+func execCredentialCachePath(a *tokentool.Authenticator) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "token-tool", "exec-credential-"+authFingerprint(a)[:16]+".json"), nil
+}
+
+// authFingerprint identifies the keystone, identity and scope a authenticates with,
+// so that cached tokens are only used for the credentials they were issued for.
+func authFingerprint(a *tokentool.Authenticator) string {
+	authOptions := a.AuthOptions
+	key := []string{
+		authOptions.IdentityEndpoint,
+		authOptions.UserID, authOptions.Username, authOptions.DomainID, authOptions.DomainName,
+		authOptions.ApplicationCredentialID, authOptions.ApplicationCredentialName,
+	}
+	if scope := authOptions.Scope; scope != nil {
+		key = append(key, scope.ProjectID, scope.ProjectName, scope.DomainID, scope.DomainName)
+	}
+	if a.EC2Credential != nil {
+		key = append(key, "ec2", a.EC2Credential.Access)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(key, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func readCachedExecCredential(path string) (tokentool.ExecCredentialStatus, error) {
+	var status tokentool.ExecCredentialStatus
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return status, err
+	}
+	if time.Until(status.ExpirationTimestamp) < execCredentialMinValidity {
+		return status, errors.New("cached credential is expired")
+	}
+	return status, nil
+}
+
+func writeCachedExecCredential(path string, status tokentool.ExecCredentialStatus) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".exec-credential-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+func TestExecCredentialCachePathDependsOnEC2Credential(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ec2 := func(access string) *tokentool.Authenticator {
+		return &tokentool.Authenticator{
+			AuthOptions:   &gophercloud.AuthOptions{IdentityEndpoint: "https://keystone.example.com/v3"},
+			EC2Credential: &tokentool.EC2Credential{Access: access, Secret: "secret"},
+		}
+	}
+
+	paths := map[string]bool{}
+	for _, a := range []*tokentool.Authenticator{ec2("access-1"), ec2("access-2"), {AuthOptions: ec2("").AuthOptions}} {
+		path, err := execCredentialCachePath(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[path] = true
+	}
+	if len(paths) != 3 {
+		t.Errorf("EC2 credentials with different access keys must not share a cache file: %v", paths)
+	}
+}
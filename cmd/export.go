@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+	"gopkg.in/yaml.v2"
+)
+
+type exportOptions struct {
+	format         string
+	cloudName      string
+	includeSecrets bool
+	useToken       bool
+}
+
+// exportedAuth is the auth section of clouds.yaml. The same names are used for the
+// OS_* variables of an openrc file.
+type exportedAuth struct {
+	AuthURL                     string `yaml:"auth_url,omitempty"`
+	Token                       string `yaml:"token,omitempty"`
+	Username                    string `yaml:"username,omitempty"`
+	UserID                      string `yaml:"user_id,omitempty"`
+	UserDomainName              string `yaml:"user_domain_name,omitempty"`
+	UserDomainID                string `yaml:"user_domain_id,omitempty"`
+	Password                    string `yaml:"password,omitempty"`
+	ApplicationCredentialID     string `yaml:"application_credential_id,omitempty"`
+	ApplicationCredentialName   string `yaml:"application_credential_name,omitempty"`
+	ApplicationCredentialSecret string `yaml:"application_credential_secret,omitempty"`
+	ProjectID                   string `yaml:"project_id,omitempty"`
+	ProjectName                 string `yaml:"project_name,omitempty"`
+	ProjectDomainName           string `yaml:"project_domain_name,omitempty"`
+	ProjectDomainID             string `yaml:"project_domain_id,omitempty"`
+	DomainName                  string `yaml:"domain_name,omitempty"`
+	DomainID                    string `yaml:"domain_id,omitempty"`
+}
+
+type exportedCloud struct {
+	Auth               exportedAuth `yaml:"auth"`
+	AuthType           string       `yaml:"auth_type,omitempty"`
+	IdentityAPIVersion string       `yaml:"identity_api_version"`
+	CACert             string       `yaml:"cacert,omitempty"`
+	Cert               string       `yaml:"cert,omitempty"`
+	Key                string       `yaml:"key,omitempty"`
+	Verify             *bool        `yaml:"verify,omitempty"`
+}
+
+// configExportCommand prints an openrc file or clouds.yaml entry matching the
+// resolved settings. Secrets are only included on request; with useToken a token is
+// issued and exported instead of the credentials.
+func configExportCommand(opts exportOptions, a *tokentool.Authenticator) error {
+	authOptions, transport := a.AuthOptions, a.Transport
+	cloud := exportedCloud{
+		AuthType:           "password",
+		IdentityAPIVersion: "3",
+		Auth: exportedAuth{
+			AuthURL: authOptions.IdentityEndpoint,
+		},
+	}
+	if transport.CACert != "" {
+		cloud.CACert = absPath(transport.CACert)
+	}
+	if transport.Insecure {
+		verify := false
+		cloud.Verify = &verify
+	}
+
+	if opts.useToken {
+		if err := exportToken(&cloud, a); err != nil {
+			return err
+		}
+	} else if err := exportCredentials(&cloud, opts.includeSecrets, a); err != nil {
+		return err
+	}
+
+	switch opts.format {
+	case "openrc":
+		fmt.Print(renderOpenrc(cloud))
+		return nil
+	case "clouds-yaml":
+		data, err := yaml.Marshal(map[string]map[string]exportedCloud{
+			"clouds": {opts.cloudName: cloud},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	default:
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown export format given: %s", opts.format))
+	}
+}
+
+func exportCredentials(cloud *exportedCloud, includeSecrets bool, a *tokentool.Authenticator) error {
+	authOptions, transport := a.AuthOptions, a.Transport
+	if transport.HasClientCert() {
+		cloud.Cert = absPath(transport.Cert)
+		if transport.Key != "" {
+			cloud.Key = absPath(transport.Key)
+		}
+	}
+
+	auth := &cloud.Auth
+	if authOptions.ApplicationCredentialID != "" || authOptions.ApplicationCredentialName != "" {
+		cloud.AuthType = "v3applicationcredential"
+		auth.ApplicationCredentialID = authOptions.ApplicationCredentialID
+		auth.ApplicationCredentialName = authOptions.ApplicationCredentialName
+		if authOptions.ApplicationCredentialName != "" {
+			auth.Username, auth.UserID = authOptions.Username, authOptions.UserID
+			auth.UserDomainName, auth.UserDomainID = authOptions.DomainName, authOptions.DomainID
+		}
+		if includeSecrets {
+			if err := a.ResolvePassword(); err != nil {
+				return err
+			}
+			auth.ApplicationCredentialSecret = authOptions.ApplicationCredentialSecret
+		}
+		//application credentials are always scoped to their project
+		return nil
+	}
+
+	auth.Username, auth.UserID = authOptions.Username, authOptions.UserID
+	auth.UserDomainName, auth.UserDomainID = authOptions.DomainName, authOptions.DomainID
+	if includeSecrets {
+		if err := a.ResolvePassword(); err != nil {
+			return err
+		}
+		auth.Password = authOptions.Password
+	}
+	if scope := authOptions.Scope; scope != nil {
+		if scope.ProjectID != "" || scope.ProjectName != "" {
+			auth.ProjectID, auth.ProjectName = scope.ProjectID, scope.ProjectName
+			auth.ProjectDomainID, auth.ProjectDomainName = scope.DomainID, scope.DomainName
+		} else {
+			auth.DomainID, auth.DomainName = scope.DomainID, scope.DomainName
+		}
+	}
+	return nil
+}
+
+func exportToken(cloud *exportedCloud, a *tokentool.Authenticator) error {
+	token, err := a.Authenticate()
+	if err != nil {
+		return err
+	}
+
+	cloud.AuthType = "v3token"
+	cloud.Auth.Token = token.ID
+	if project, err := token.Result.ExtractProject(); err == nil && project != nil {
+		cloud.Auth.ProjectID = project.ID
+	} else if domain, err := token.Result.ExtractDomain(); err == nil && domain != nil {
+		cloud.Auth.DomainID = domain.ID
+	}
+	return nil
+}
+
+// renderOpenrc renders cloud as shell script exporting the OS_* variables.
+func renderOpenrc(cloud exportedCloud) string {
+	auth := cloud.Auth
+	vars := []struct{ name, value string }{
+		{"OS_AUTH_URL", auth.AuthURL},
+		{"OS_AUTH_TYPE", cloud.AuthType},
+		{"OS_IDENTITY_API_VERSION", cloud.IdentityAPIVersion},
+		{"OS_TOKEN", auth.Token},
+		{"OS_USERNAME", auth.Username},
+		{"OS_USER_ID", auth.UserID},
+		{"OS_USER_DOMAIN_NAME", auth.UserDomainName},
+		{"OS_USER_DOMAIN_ID", auth.UserDomainID},
+		{"OS_PASSWORD", auth.Password},
+		{"OS_APPLICATION_CREDENTIAL_ID", auth.ApplicationCredentialID},
+		{"OS_APPLICATION_CREDENTIAL_NAME", auth.ApplicationCredentialName},
+		{"OS_APPLICATION_CREDENTIAL_SECRET", auth.ApplicationCredentialSecret},
+		{"OS_PROJECT_ID", auth.ProjectID},
+		{"OS_PROJECT_NAME", auth.ProjectName},
+		{"OS_PROJECT_DOMAIN_NAME", auth.ProjectDomainName},
+		{"OS_PROJECT_DOMAIN_ID", auth.ProjectDomainID},
+		{"OS_DOMAIN_NAME", auth.DomainName},
+		{"OS_DOMAIN_ID", auth.DomainID},
+		{"OS_CACERT", cloud.CACert},
+		{"OS_CERT", cloud.Cert},
+		{"OS_KEY", cloud.Key},
+	}
+	if cloud.Verify != nil && !*cloud.Verify {
+		vars = append(vars, struct{ name, value string }{"OS_INSECURE", "true"})
+	}
+
+	var b strings.Builder
+	for _, v := range vars {
+		if v.value != "" {
+			fmt.Fprintf(&b, "export %s=%s\n", v.name, shellescape.Quote(v.value))
+		}
+	}
+	return b.String()
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+	"gopkg.in/yaml.v2"
+)
+
+// gitCredentialsConfig maps "host" or "host/path" prefixes to keystone scopes.
+type gitCredentialsConfig struct {
+	Hosts map[string]keystoneScope `yaml:"hosts"`
+}
+
+// gitCredentialCommand implements git's credential helper protocol. Only "get" does
+// something: it returns a fresh token for the scope mapped to the requested host.
+// Tokens are never stored, so "store" and "erase" just consume their input.
+func gitCredentialCommand(action string, authInfo *clientconfig.AuthInfo, a *tokentool.Authenticator) error {
+	request, err := readGitCredentialRequest(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "get":
+		path, err := gitCredentialsConfigPath()
+		if err != nil {
+			return err
+		}
+		config, err := readGitCredentialsConfig(path)
+		if err != nil {
+			return err
+		}
+		scope, ok := config.Lookup(request["host"], request["path"])
+		if !ok {
+			//no answer lets git continue with the next helper
+			return nil
+		}
+		token, err := issueScopedToken(scope, authInfo, a)
+		if err != nil {
+			return err
+		}
+		username := scope.Username
+		if username == "" {
+			username = "token"
+		}
+		fmt.Printf("username=%s\n", username)
+		fmt.Printf("password=%s\n", token.ID)
+		fmt.Printf("password_expiry_utc=%d\n", token.ExpiresAt.Unix())
+		return nil
+	case "store", "erase":
+		return nil
+	default:
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown credential helper action %q, expected get, store or erase", action))
+	}
+}
+
+// readGitCredentialRequest parses the key=value lines sent by git until the first
+// empty line or EOF.
+func readGitCredentialRequest(in io.Reader) (map[string]string, error) {
+	request := map[string]string{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("invalid credential helper input line %q", line))
+		}
+		request[key] = value
+	}
+	return request, scanner.Err()
+}
+
+// Lookup returns the scope of the longest configured prefix matching host and path.
+func (c gitCredentialsConfig) Lookup(host, path string) (keystoneScope, bool) {
+	target := strings.TrimRight(host+"/"+strings.Trim(path, "/"), "/")
+	var best string
+	var result keystoneScope
+	found := false
+	for prefix, scope := range c.Hosts {
+		prefix = strings.TrimRight(prefix, "/")
+		if target != prefix && !strings.HasPrefix(target, prefix+"/") {
+			continue
+		}
+		if !found || len(prefix) > len(best) {
+			best, result, found = prefix, scope, true
+		}
+	}
+	return result, found
+}
+
+func gitCredentialsConfigPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", tokentool.WithKind(tokentool.KindConfiguration, err)
+	}
+	return filepath.Join(configDir, "token-tool", "git-credentials.yaml"), nil
+}
+
+func readGitCredentialsConfig(path string) (*gitCredentialsConfig, error) {
+	config := &gitCredentialsConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, tokentool.WithKind(tokentool.KindConfiguration, err)
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("failed to parse %s: %w", path, err))
+	}
+	return config, nil
+}
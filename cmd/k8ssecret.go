@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+type k8sSecretOptions struct {
+	name        string
+	namespace   string
+	labels      []string
+	keys        []string
+	includeJSON bool
+}
+
+// Formatter builds the formatter for --format k8s-secret. Labels are given as
+// key=value, keys as field=key, e.g. token=OS_AUTH_TOKEN.
+func (o k8sSecretOptions) Formatter() (tokentool.K8sSecretFormatter, error) {
+	formatter := tokentool.K8sSecretFormatter{
+		Name:        o.name,
+		Namespace:   o.namespace,
+		IncludeJSON: o.includeJSON,
+	}
+	for _, label := range o.labels {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return formatter, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("invalid label %q, expected key=value", label))
+		}
+		if formatter.Labels == nil {
+			formatter.Labels = map[string]string{}
+		}
+		formatter.Labels[key] = value
+	}
+
+	fields := map[string]*string{
+		"token":             &formatter.Keys.Token,
+		"expires_at":        &formatter.Keys.ExpiresAt,
+		"user_id":           &formatter.Keys.UserID,
+		"project_id":        &formatter.Keys.ProjectID,
+		"project_domain_id": &formatter.Keys.ProjectDomainID,
+		"domain_id":         &formatter.Keys.DomainID,
+		"json":              &formatter.Keys.JSON,
+	}
+	for _, mapping := range o.keys {
+		field, key, _ := strings.Cut(mapping, "=")
+		target, ok := fields[field]
+		if !ok || key == "" {
+			return formatter, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("invalid secret key %q, expected field=key with field one of "+
+				"token, expires_at, user_id, project_id, project_domain_id, domain_id, json", mapping))
+		}
+		*target = key
+	}
+	return formatter, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/howeyc/gopass"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+	"golang.org/x/term"
+)
+
+type keyringOptions struct {
+	backend      string
+	file         string
+	unlockPeriod time.Duration
+}
+
+// Keyring returns the keyring selected with --keyring-backend. "auto" uses the
+// system keyring and falls back to the file keyring if it is not available.
+func (o keyringOptions) Keyring() (tokentool.Keyring, error) {
+	switch o.backend {
+	case "auto", "":
+		return tokentool.FallbackKeyring{Primary: tokentool.SystemKeyring{}, Fallback: o.fileKeyring()}, nil
+	case "system":
+		return tokentool.SystemKeyring{}, nil
+	case "file":
+		return o.fileKeyring(), nil
+	case "none":
+		return tokentool.NoKeyring{}, nil
+	default:
+		return nil, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown keyring backend %q, expected auto, system, file or none", o.backend))
+	}
+}
+
+func (o keyringOptions) fileKeyring() tokentool.FileKeyring {
+	return tokentool.FileKeyring{
+		Path:           o.file,
+		UnlockDuration: o.unlockPeriod,
+		Passphrase:     keyringPassphrase,
+	}
+}
+
+// keyringPassphrase returns the master passphrase of the file keyring from
+// $TOKEN_KEYRING_PASSPHRASE or a prompt.
+func keyringPassphrase(create bool) (string, error) {
+	if pw := os.Getenv("TOKEN_KEYRING_PASSPHRASE"); pw != "" {
+		return pw, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", tokentool.ErrKeyringLocked
+	}
+	if create {
+		log.Println("Creating a new file keyring, choose a passphrase to protect it")
+	}
+	passphrase, err := gopass.GetPasswdPrompt("Keyring passphrase: ", true, os.Stdin, os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read keyring passphrase: %w", err)
+	}
+	if create {
+		confirmation, err := gopass.GetPasswdPrompt("Confirm keyring passphrase: ", true, os.Stdin, os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read keyring passphrase: %w", err)
+		}
+		if string(passphrase) != string(confirmation) {
+			return "", tokentool.WithKind(tokentool.KindConfiguration, errors.New("the keyring passphrases do not match"))
+		}
+	}
+	return string(passphrase), nil
+}
+
+// certPassphrase returns the callback for tokentool.Transport.CertPassphrase. It
+// takes the passphrase of an encrypted key or bundle from $OS_CERT_PASSPHRASE, the
+// keyring (service openstack-cert, the absolute path as user) or a prompt.
+func certPassphrase(kr tokentool.Keyring) func(path string) (string, error) {
+	return func(path string) (string, error) {
+		if pw := os.Getenv("OS_CERT_PASSPHRASE"); pw != "" {
+			return pw, nil
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			if pw, err := kr.Get("openstack-cert", abs); err == nil {
+				log.Println("Using certificate passphrase from keyring")
+				return pw, nil
+			}
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("%s is encrypted, but no passphrase was given (set $OS_CERT_PASSPHRASE)", path))
+		}
+		passphrase, err := gopass.GetPasswdPrompt(fmt.Sprintf("Passphrase for %s: ", path), true, os.Stdin, os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		return string(passphrase), nil
+	}
+}
+
+// keyringSetCommand stores a secret read from the terminal or the first line of
+// stdin in the selected keyring.
+func keyringSetCommand(kr tokentool.Keyring, service, user string) error {
+	if user == "" {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("usage: token keyring set [--service NAME] USER"))
+	}
+	var secret string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		pw, err := gopass.GetPasswdPrompt(fmt.Sprintf("Secret for %s/%s: ", service, user), true, os.Stdin, os.Stderr)
+		if err != nil {
+			return fmt.Errorf("failed to read secret: %w", err)
+		}
+		secret = string(pw)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read secret from stdin: %w", err)
+		}
+		secret = strings.TrimRight(line, "\r\n")
+	}
+	if secret == "" {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("the secret must not be empty"))
+	}
+	if err := kr.Set(service, user, secret); err != nil {
+		return fmt.Errorf("failed to store secret in keyring: %w", err)
+	}
+	log.Printf("Stored secret for %s/%s in keyring", service, user)
+	return nil
+}
+
+func keyringDeleteCommand(kr tokentool.Keyring, service, user string) error {
+	if user == "" {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("usage: token keyring delete [--service NAME] USER"))
+	}
+	err := kr.Delete(service, user)
+	if errors.Is(err, tokentool.ErrKeyringNotFound) {
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("no secret for %s/%s in keyring", service, user))
+	}
+	return err
+}
+
+func keyringLockCommand(opts keyringOptions) error {
+	return opts.fileKeyring().Lock()
+}
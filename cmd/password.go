@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/howeyc/gopass"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+	"golang.org/x/term"
+)
+
+// expiredPasswordHandler returns the callback for
+// tokentool.Authenticator.OnPasswordExpired. It explains the expired password error
+// and, when running interactively, offers to change the password right away. On
+// success the new password is stored in the auth options, so that the
+// authenticator can retry.
+func expiredPasswordHandler(kr tokentool.Keyring) func(a *tokentool.Authenticator, authErr error) error {
+	return func(a *tokentool.Authenticator, authErr error) error {
+		explanation := fmt.Errorf("your keystone password is expired and needs to be changed, run `token password change`: %w", authErr)
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return explanation
+		}
+
+		fmt.Fprint(os.Stderr, "Your keystone password is expired. Change it now? [y/N] ")
+		var answer string
+		_, _ = fmt.Scanln(&answer)
+		if answer != "y" && answer != "Y" && answer != "yes" {
+			return explanation
+		}
+		return changePassword(kr, a)
+	}
+}
+
+func passwordChangeCommand(out outputOptions, kr tokentool.Keyring, a *tokentool.Authenticator) error {
+	if err := a.ResolvePassword(); err != nil {
+		return err
+	}
+	if err := changePassword(kr, a); err != nil {
+		return err
+	}
+	return tokenCommand(out, a)
+}
+
+// changePassword prompts for a new password, changes it in keystone and updates the
+// keyring entry if one exists.
+func changePassword(kr tokentool.Keyring, a *tokentool.Authenticator) error {
+	if a.AuthOptions.Password == "" {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("the current password is required to change it"))
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("changing the password requires an interactive terminal"))
+	}
+
+	newPassword, err := gopass.GetPasswdPrompt("New password: ", true, os.Stdin, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to read new password: %w", err)
+	}
+	confirmation, err := gopass.GetPasswdPrompt("Confirm new password: ", true, os.Stdin, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to read new password: %w", err)
+	}
+	if string(newPassword) != string(confirmation) {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("the new passwords do not match"))
+	}
+
+	if err := a.ChangePassword(string(newPassword)); err != nil {
+		return err
+	}
+	log.Println("Password changed")
+
+	if username := a.AuthOptions.Username; username != "" {
+		if _, err := kr.Get("openstack", username); err == nil {
+			if err := kr.Set("openstack", username, string(newPassword)); err != nil {
+				log.Printf("WARNING: failed to update the password in the keyring: %s", err)
+			} else {
+				log.Println("Updated password in keyring")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+// defaultPasswordSources is used without --password-source. The file, command and
+// pipe sources are skipped unless their flag is given.
+const defaultPasswordSources = "env,file,command,pipe,keyring,prompt"
+
+type passwordSourceOptions struct {
+	sources string
+	file    string
+	command string
+	pipe    string
+	stdin   bool
+
+	commandTimeout time.Duration
+}
+
+// PasswordSources builds the chain of password sources in the configured order. The
+// keyring source uses kr.
+// With --password-stdin the password is read from stdin only. The chain ends with a
+// source failing with an explanation, so that non-interactive runs do not send an
+// empty password to keystone.
+func (o passwordSourceOptions) PasswordSources(kr tokentool.Keyring) ([]tokentool.PasswordSource, error) {
+	if o.stdin {
+		if o.sources != "" {
+			return nil, tokentool.WithKind(tokentool.KindConfiguration, errors.New("--password-stdin cannot be combined with --password-source"))
+		}
+		return []tokentool.PasswordSource{tokentool.StdinSource{}, missingPasswordSource}, nil
+	}
+
+	explicit := o.sources != ""
+	names := o.sources
+	if !explicit {
+		names = defaultPasswordSources
+	}
+
+	var sources []tokentool.PasswordSource
+	for _, name := range strings.Split(names, ",") {
+		var source tokentool.PasswordSource
+		setting := "-"
+		switch name = strings.TrimSpace(name); name {
+		case "env":
+			source = tokentool.EnvSource{}
+		case "keyring":
+			source = tokentool.KeyringSource{Keyring: kr}
+		case "prompt":
+			source = tokentool.PromptSource{}
+		case "file":
+			source, setting = tokentool.FileSource{Path: o.file}, o.file
+		case "command":
+			source, setting = tokentool.CommandSource{Command: o.command, Timeout: o.commandTimeout}, o.command
+		case "pipe":
+			source, setting = tokentool.PipeSource{Path: o.pipe}, o.pipe
+		case "stdin":
+			return nil, tokentool.WithKind(tokentool.KindConfiguration, errors.New("use --password-stdin to read the password from stdin"))
+		default:
+			return nil, tokentool.WithKind(tokentool.KindConfiguration,
+				fmt.Errorf("unknown password source %q, expected a list of env, keyring, prompt, file, command, pipe", name))
+		}
+		if setting == "" {
+			if explicit {
+				return nil, tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("password source %q requires --password-%s", name, name))
+			}
+			continue
+		}
+		sources = append(sources, source)
+	}
+	return append(sources, missingPasswordSource), nil
+}
+
+// missingPasswordSource fails when none of the configured sources has a password.
+var missingPasswordSource = tokentool.PasswordSourceFunc(func(authOptions *gophercloud.AuthOptions) (string, error) {
+	return "", tokentool.WithKind(tokentool.KindConfiguration, errors.New("no password available: "+
+		"pass it with --password-stdin, --password-command or --password-file, store it in the keyring or run on a terminal"))
+})
+
+// resolveAuthOptions resolves the auth options like tokentool.ResolveAuthOptions,
+// but leaves secrets from $OS_PASSWORD and $OS_APPLICATION_CREDENTIAL_SECRET to the
+// env password source, so that they are only used if and when the source chain says
+// so.
+func resolveAuthOptions(authInfo *clientconfig.AuthInfo) (*gophercloud.AuthOptions, error) {
+	authOpts, err := tokentool.ResolveAuthOptions(authInfo)
+	if err != nil {
+		return nil, err
+	}
+	if pw := os.Getenv("OS_PASSWORD"); pw != "" && authOpts.Password == pw {
+		authOpts.Password = ""
+	}
+	if secret := os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET"); secret != "" && authOpts.ApplicationCredentialSecret == secret {
+		authOpts.ApplicationCredentialSecret = ""
+	}
+	return authOpts, nil
+}
+
+// nonInteractive returns a copy of a that neither prompts for the password nor reads
+// it from stdin, e.g. for commands whose stdin carries protocol messages.
+func nonInteractive(a *tokentool.Authenticator) *tokentool.Authenticator {
+	result := *a
+	result.PasswordSources = nil
+	for _, source := range a.PasswordSources {
+		switch source.(type) {
+		case tokentool.PromptSource, tokentool.StdinSource:
+			continue
+		}
+		result.PasswordSources = append(result.PasswordSources, source)
+	}
+	return &result
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// profileKeys maps the keys allowed in a profile to the global flags they provide
+// defaults for.
+var profileKeys = map[string]string{
+	"auth_url":                    "auth-url",
+	"auth_type":                   "auth-type",
+	"username":                    "username",
+	"user_id":                     "user-id",
+	"user_domain_name":            "user-domain-name",
+	"user_domain_id":              "user-domain-id",
+	"project_name":                "project-name",
+	"project_id":                  "project-id",
+	"project_domain_name":         "project-domain-name",
+	"project_domain_id":           "project-domain-id",
+	"domain_name":                 "domain-name",
+	"domain_id":                   "domain-id",
+	"application_credential_id":   "application-credential-id",
+	"application_credential_name": "application-credential-name",
+	"cert":                        "cert",
+	"key":                         "key",
+	"cacert":                      "cacert",
+	"insecure":                    "insecure",
+	"format":                      "format",
+	"region":                      "region",
+	"password_source":             "password-source",
+	"password_file":               "password-file",
+	"password_command":            "password-command",
+	"password_pipe":               "password-pipe",
+	"keyring_backend":             "keyring-backend",
+	"k8s_secret_name":             "k8s-secret-name",
+	"k8s_secret_namespace":        "k8s-secret-namespace",
+}
+
+type profile map[string]string
+
+type toolConfig struct {
+	DefaultProfile string             `yaml:"default_profile,omitempty"`
+	Profiles       map[string]profile `yaml:"profiles"`
+}
+
+func toolConfigPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", tokentool.WithKind(tokentool.KindConfiguration, err)
+	}
+	return filepath.Join(configDir, "token-tool", "config.yaml"), nil
+}
+
+func readToolConfig() (*toolConfig, string, error) {
+	path, err := toolConfigPath()
+	if err != nil {
+		return nil, "", err
+	}
+	config := &toolConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", tokentool.WithKind(tokentool.KindConfiguration, err)
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, "", tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("failed to parse %s: %w", path, err))
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]profile{}
+	}
+	return config, path, nil
+}
+
+func writeToolConfig(config *toolConfig, path string) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// applyProfile sets all flags that were neither given on the command line nor via
+// their environment variable to the values of the selected profile. This yields
+// the precedence flag > env > profile > default.
+func applyProfile(c *cli.Context, name string) error {
+	config, path, err := readToolConfig()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = config.DefaultProfile
+	}
+	if name == "" {
+		return nil
+	}
+	p, ok := config.Profiles[name]
+	if !ok {
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("profile %q not found in %s", name, path))
+	}
+
+	for key, value := range p {
+		flagName, ok := profileKeys[key]
+		if !ok {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown key %q in profile %q", key, name))
+		}
+		if c.GlobalIsSet(flagName) {
+			continue
+		}
+		if err := c.GlobalSet(flagName, value); err != nil {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("invalid value for %q in profile %q: %w", key, name, err))
+		}
+	}
+	return nil
+}
+
+func profileListCommand() error {
+	config, _, err := readToolConfig()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		marker := " "
+		if name == config.DefaultProfile {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, name)
+	}
+	return nil
+}
+
+func profileShowCommand(name string) error {
+	config, _, err := readToolConfig()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = config.DefaultProfile
+	}
+	p, ok := config.Profiles[name]
+	if !ok {
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("profile %q not found", name))
+	}
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// profileSetCommand sets the given key=value pairs in the profile, creating it if
+// necessary. An empty value removes the key.
+func profileSetCommand(name string, assignments []string, makeDefault bool) error {
+	if name == "" {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("usage: token profile set NAME [key=value...]"))
+	}
+	config, path, err := readToolConfig()
+	if err != nil {
+		return err
+	}
+	p := config.Profiles[name]
+	if p == nil {
+		p = profile{}
+	}
+	for _, assignment := range assignments {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("invalid assignment %q, expected key=value", assignment))
+		}
+		if _, ok := profileKeys[key]; !ok {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown profile key %q, expected one of: %s", key, strings.Join(sortedProfileKeys(), ", ")))
+		}
+		if value == "" {
+			delete(p, key)
+		} else {
+			p[key] = value
+		}
+	}
+	config.Profiles[name] = p
+	if makeDefault {
+		config.DefaultProfile = name
+	}
+	return writeToolConfig(config, path)
+}
+
+func profileDeleteCommand(name string) error {
+	config, path, err := readToolConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Profiles[name]; !ok {
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("profile %q not found", name))
+	}
+	delete(config.Profiles, name)
+	if config.DefaultProfile == name {
+		config.DefaultProfile = ""
+	}
+	return writeToolConfig(config, path)
+}
+
+func sortedProfileKeys() []string {
+	keys := make([]string, 0, len(profileKeys))
+	for key := range profileKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+type reuseOptions struct {
+	path        string
+	minValidity time.Duration
+}
+
+// issueOrReuseToken returns the token from the --reuse-file if it was issued for the
+// same keystone, user and scope and is still valid for at least --min-validity.
+// Otherwise a new token is issued and the file is replaced.
+func issueOrReuseToken(opts reuseOptions, a *tokentool.Authenticator) (*tokentool.Token, error) {
+	if opts.path == "" {
+		return a.Authenticate()
+	}
+	fingerprint := authFingerprint(a)
+	token, fileFingerprint, err := tokentool.ReadTokenFile(opts.path)
+	switch {
+	case err != nil:
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: ignoring token file: %s", err)
+		}
+	case fileFingerprint != fingerprint:
+		log.Printf("Replacing token file %s, it was issued for other credentials or another scope", opts.path)
+	case token.ExpiresIn() >= opts.minValidity:
+		return token, nil
+	}
+
+	token, err = a.Authenticate()
+	if err != nil {
+		return nil, err
+	}
+	if err := tokentool.WriteTokenFile(opts.path, token, fingerprint); err != nil {
+		log.Printf("WARNING: failed to write token file: %s", err)
+	}
+	return token, nil
+}
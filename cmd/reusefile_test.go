@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+func TestReuseFileChecksFingerprint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	token := &tokentool.Token{ID: "cached-token", ExpiresAt: time.Now().Add(time.Hour)}
+	token.Result.Body = map[string]interface{}{}
+
+	scope := func(project string) *tokentool.Authenticator {
+		return &tokentool.Authenticator{AuthOptions: &gophercloud.AuthOptions{
+			Username: "alice",
+			Scope:    &gophercloud.AuthScope{ProjectName: project, DomainName: "Default"},
+		}}
+	}
+	if err := tokentool.WriteTokenFile(path, token, authFingerprint(scope("demo"))); err != nil {
+		t.Fatal(err)
+	}
+	opts := reuseOptions{path: path, minValidity: time.Minute}
+
+	reused, err := issueOrReuseToken(opts, scope("demo"))
+	if err != nil || reused.ID != "cached-token" {
+		t.Fatalf("got %v, %v, expected the cached token for the same scope", reused, err)
+	}
+	//without an auth URL, issuing a new token fails instead of returning the cached one
+	if reused, err := issueOrReuseToken(opts, scope("other")); err == nil {
+		t.Errorf("got token %s for another project, expected a new token to be issued", reused.ID)
+	}
+}
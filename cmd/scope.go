@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+// keystoneScope maps a resource like a registry or git server to the keystone scope
+// whose tokens it accepts.
+type keystoneScope struct {
+	Username          string `yaml:"username,omitempty"`
+	ProjectID         string `yaml:"project_id,omitempty"`
+	ProjectName       string `yaml:"project_name,omitempty"`
+	ProjectDomainID   string `yaml:"project_domain_id,omitempty"`
+	ProjectDomainName string `yaml:"project_domain_name,omitempty"`
+	DomainID          string `yaml:"domain_id,omitempty"`
+	DomainName        string `yaml:"domain_name,omitempty"`
+}
+
+// AuthScope converts the scope into its gophercloud representation.
+func (s keystoneScope) AuthScope() *gophercloud.AuthScope {
+	if s.ProjectID == "" && s.ProjectName == "" {
+		return &gophercloud.AuthScope{DomainID: s.DomainID, DomainName: s.DomainName}
+	}
+	return &gophercloud.AuthScope{
+		ProjectID:   s.ProjectID,
+		ProjectName: s.ProjectName,
+		DomainID:    s.ProjectDomainID,
+		DomainName:  s.ProjectDomainName,
+	}
+}
+
+// issueScopedToken issues a token for scope, using the same credentials as the
+// token command. It is used by the credential helpers, whose stdin carries protocol
+// messages, so the password is never read from stdin.
+func issueScopedToken(scope keystoneScope, authInfo *clientconfig.AuthInfo, a *tokentool.Authenticator) (*tokentool.Token, error) {
+	authOpts, err := resolveAuthOptions(authInfo)
+	if err != nil {
+		return nil, err
+	}
+	authOpts.Scope = scope.AuthScope()
+
+	scoped := nonInteractive(a)
+	scoped.AuthOptions = authOpts
+	return scoped.Authenticate()
+}
@@ -1,65 +1,45 @@
 package main
 
 import (
-	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"sort"
 	"strings"
-	"syscall"
+	"time"
 
-	"github.com/gophercloud/gophercloud"
-	"github.com/gophercloud/gophercloud/openstack"
-	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
 	"github.com/gophercloud/utils/openstack/clientconfig"
-	"github.com/howeyc/gopass"
+	"github.com/sapcc/token-tool/pkg/tokentool"
 	"github.com/urfave/cli"
-	"github.com/zalando/go-keyring"
-	"golang.org/x/term"
 )
 
 var version string = "HEAD"
 
-type transportInfo struct {
-	cert string
-	key  string
-}
-
-func (ti transportInfo) IsConfigured() bool {
-	return ti.cert != "" && ti.key != ""
-}
-
-func (ti transportInfo) InjectIfConfigured(provider *gophercloud.ProviderClient) error {
-	if !ti.IsConfigured() {
-		return nil
-	}
-	cert, err := tls.LoadX509KeyPair(ti.cert, ti.key)
-	if err != nil {
-		return fmt.Errorf("failed to load x509 keypair: %w", err)
-	}
-	transport := &http.Transport{}
-	transport.TLSClientConfig = &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
-	}
-	provider.HTTPClient = http.Client{
-		Transport: transport,
-	}
-	return nil
+// offlineCommands do not talk to keystone, so credentials are not resolved for them.
+var offlineCommands = map[string]bool{
+	"cert":              true,
+	"docker-credential": true,
+	"git-credential":    true,
+	"profile":           true,
+	"keyring":           true,
+	"help":              true,
+	"h":                 true,
 }
 
 func main() {
 	var authInfo clientconfig.AuthInfo
-	var transportInfo transportInfo
+	var transport tokentool.Transport
+	var passwordOptions passwordSourceOptions
+	var keyringOpts keyringOptions
+	var reuseOpts reuseOptions
+	var k8sSecretOpts k8sSecretOptions
+	var ec2Opts ec2AuthOptions
+	var errorFormat string
 	// handling args/flags
 	app := cli.NewApp()
 	app.Version = version
+	tokentool.Version = version
 
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
@@ -102,7 +82,7 @@ func main() {
 			Name:        "project-domain-id",
 			Usage:       "Project domain ID",
 			EnvVar:      "OS_PROJECT_DOMAIN_ID",
-			Destination: &authInfo.ProjectDomainName,
+			Destination: &authInfo.ProjectDomainID,
 		},
 		cli.StringFlag{
 			Name:        "domain-name",
@@ -114,7 +94,7 @@ func main() {
 			Name:        "domain-id",
 			Usage:       "domain ID (domain scope)",
 			EnvVar:      "OS_DOMAIN_ID",
-			Destination: &authInfo.ProjectDomainName,
+			Destination: &authInfo.DomainID,
 		},
 		cli.StringFlag{
 			Name:        "project-id",
@@ -140,179 +120,663 @@ func main() {
 			EnvVar:      "OS_APPLICATION_CREDENTIAL_NAME",
 			Destination: &authInfo.ApplicationCredentialName,
 		},
+		cli.StringFlag{
+			Name:        "auth-type",
+			Usage:       "v3ec2credential authenticates with --ec2-access-key, other values are ignored and the method is chosen by the given credentials",
+			EnvVar:      "OS_AUTH_TYPE",
+			Destination: &ec2Opts.authType,
+		},
+		cli.StringFlag{
+			Name:        "ec2-access-key",
+			Usage:       "EC2 access key for --auth-type v3ec2credential, the secret key is read from $AWS_SECRET_ACCESS_KEY",
+			EnvVar:      "AWS_ACCESS_KEY_ID",
+			Destination: &ec2Opts.access,
+		},
 		cli.StringFlag{
 			Name:        "cert",
-			Usage:       "2FA cert file path",
+			Usage:       "2FA cert file path (PEM or PKCS#12 bundle, encrypted files are unlocked with $OS_CERT_PASSPHRASE, the keyring or a prompt)",
 			EnvVar:      "OS_CERT",
-			Destination: &transportInfo.cert,
+			Destination: &transport.Cert,
 			TakesFile:   true,
 		},
 		cli.StringFlag{
 			Name:        "key",
-			Usage:       "2FA key file path",
+			Usage:       "2FA key file path (optional if the cert file contains the key)",
 			EnvVar:      "OS_KEY",
-			Destination: &transportInfo.key,
+			Destination: &transport.Key,
+			TakesFile:   true,
+		},
+		cli.StringFlag{
+			Name:        "cacert",
+			Usage:       "CA bundle file path used to verify the server certificates",
+			EnvVar:      "OS_CACERT",
+			Destination: &transport.CACert,
+			TakesFile:   true,
+		},
+		cli.BoolFlag{
+			Name:        "insecure",
+			Usage:       "disable server certificate verification (dangerous!)",
+			EnvVar:      "OS_INSECURE",
+			Destination: &transport.Insecure,
+		},
+		cli.StringFlag{
+			Name:        "tls-min-version",
+			Value:       "1.2",
+			Usage:       "Minimum TLS version: 1.0, 1.1, 1.2, 1.3",
+			EnvVar:      "OS_TLS_MIN_VERSION",
+			Destination: &transport.MinTLSVersion,
+		},
+		cli.StringFlag{
+			Name:        "tls-server-name",
+			Usage:       "override the server name used to verify the server certificate",
+			EnvVar:      "OS_TLS_SERVER_NAME",
+			Destination: &transport.ServerName,
+		},
+		cli.DurationFlag{
+			Name:        "cert-expiry-warning",
+			Value:       14 * 24 * time.Hour,
+			Usage:       "warn when the 2FA cert expires within this duration",
+			EnvVar:      "OS_CERT_EXPIRY_WARNING",
+			Destination: &transport.ExpiryWarning,
+		},
+		cli.DurationFlag{
+			Name:        "timeout",
+			Value:       60 * time.Second,
+			Usage:       "overall timeout for each HTTP request including retries (0 disables the timeout)",
+			EnvVar:      "OS_TIMEOUT",
+			Destination: &transport.Timeout,
+		},
+		cli.DurationFlag{
+			Name:        "connect-timeout",
+			Value:       10 * time.Second,
+			Usage:       "timeout for establishing connections (also passed to curl)",
+			EnvVar:      "OS_CONNECT_TIMEOUT",
+			Destination: &transport.ConnectTimeout,
+		},
+		cli.IntFlag{
+			Name:        "retries",
+			Value:       3,
+			Usage:       "number of retries for failed idempotent requests and 429/5xx responses",
+			EnvVar:      "OS_RETRIES",
+			Destination: &transport.Retries,
+		},
+		cli.BoolFlag{
+			Name:        "debug",
+			Usage:       "trace all HTTP requests on stderr (secrets are redacted)",
+			EnvVar:      "OS_DEBUG",
+			Destination: &transport.Debug,
+		},
+		cli.StringFlag{
+			Name:        "debug-har",
+			Usage:       "write a trace of all HTTP requests as HAR file (secrets are redacted)",
+			Destination: &transport.HARFile,
+			TakesFile:   true,
+		},
+		cli.StringFlag{
+			Name:        "password-source",
+			Usage:       "comma separated list of password sources tried in order: env, keyring, prompt, file, command, pipe (default: " + defaultPasswordSources + ")",
+			EnvVar:      "TOKEN_PASSWORD_SOURCE",
+			Destination: &passwordOptions.sources,
+		},
+		cli.BoolFlag{
+			Name:        "password-stdin",
+			Usage:       "read the password from the first line of stdin (the rest stays available, e.g. for curl -d @-)",
+			Destination: &passwordOptions.stdin,
+		},
+		cli.StringFlag{
+			Name:        "password-file",
+			Usage:       "read the password from the first line of this file",
+			Destination: &passwordOptions.file,
+			TakesFile:   true,
+		},
+		cli.StringFlag{
+			Name:        "password-command",
+			Usage:       "run this shell command and use its output as password or application credential secret, e.g. 'pass show openstack'",
+			EnvVar:      "TOKEN_PASSWORD_COMMAND",
+			Destination: &passwordOptions.command,
+		},
+		cli.DurationFlag{
+			Name:        "password-command-timeout",
+			Value:       tokentool.DefaultSourceTimeout,
+			Usage:       "abort the password command after this duration",
+			EnvVar:      "TOKEN_PASSWORD_COMMAND_TIMEOUT",
+			Destination: &passwordOptions.commandTimeout,
+		},
+		cli.StringFlag{
+			Name:        "password-pipe",
+			Usage:       "read the password from the first line written to this named pipe",
+			Destination: &passwordOptions.pipe,
+			TakesFile:   true,
+		},
+		cli.StringFlag{
+			Name:        "keyring-backend",
+			Value:       "auto",
+			Usage:       "keyring for passwords and certificate passphrases: auto (system, file if unavailable), system, file, none",
+			EnvVar:      "TOKEN_KEYRING_BACKEND",
+			Destination: &keyringOpts.backend,
+		},
+		cli.StringFlag{
+			Name:        "keyring-file",
+			Usage:       "path of the encrypted file keyring (default: $XDG_DATA_HOME/token-tool/keyring.json)",
+			EnvVar:      "TOKEN_KEYRING_FILE",
+			Destination: &keyringOpts.file,
 			TakesFile:   true,
 		},
+		cli.DurationFlag{
+			Name:        "keyring-unlock-time",
+			Value:       15 * time.Minute,
+			Usage:       "keep the file keyring unlocked for this duration (0 asks for the passphrase every time)",
+			EnvVar:      "TOKEN_KEYRING_UNLOCK_TIME",
+			Destination: &keyringOpts.unlockPeriod,
+		},
+		cli.StringFlag{
+			Name:        "error-format",
+			Value:       "text",
+			Usage:       "Format of errors printed on stderr: text, json",
+			EnvVar:      "TOKEN_ERROR_FORMAT",
+			Destination: &errorFormat,
+		},
 		cli.StringFlag{
 			Name:  "format, f",
 			Value: "text",
-			Usage: "Format: text, json, curlrc",
+			Usage: "Format: text, json, curlrc, exec-credential, k8s-secret",
+		},
+		cli.StringFlag{
+			Name:        "k8s-secret-name",
+			Value:       "openstack-token",
+			Usage:       "name of the Secret printed with --format k8s-secret",
+			Destination: &k8sSecretOpts.name,
+		},
+		cli.StringFlag{
+			Name:        "k8s-secret-namespace",
+			Usage:       "namespace of the Secret printed with --format k8s-secret",
+			Destination: &k8sSecretOpts.namespace,
+		},
+		cli.StringSliceFlag{
+			Name:  "k8s-secret-label",
+			Usage: "label key=value of the Secret printed with --format k8s-secret (can be repeated)",
+		},
+		cli.StringSliceFlag{
+			Name:  "k8s-secret-key",
+			Usage: "rename a value of the Secret with field=key, fields: token, expires_at, user_id, project_id, project_domain_id, domain_id, json (can be repeated)",
+		},
+		cli.BoolFlag{
+			Name:        "k8s-secret-include-json",
+			Usage:       "add the token in the json format to the Secret (key token.json)",
+			Destination: &k8sSecretOpts.includeJSON,
+		},
+		cli.StringFlag{
+			Name:        "reuse-file",
+			Usage:       "keep the token as JSON in this file and reuse it while it is valid for at least --min-validity",
+			EnvVar:      "TOKEN_REUSE_FILE",
+			Destination: &reuseOpts.path,
+			TakesFile:   true,
+		},
+		cli.DurationFlag{
+			Name:        "min-validity",
+			Value:       30 * time.Minute,
+			Usage:       "minimum remaining validity of a token from --reuse-file",
+			EnvVar:      "TOKEN_MIN_VALIDITY",
+			Destination: &reuseOpts.minValidity,
+		},
+		cli.StringFlag{
+			Name:   "region",
+			Usage:  "only use endpoints of this region from the service catalog",
+			EnvVar: "OS_REGION_NAME",
+		},
+		cli.StringFlag{
+			Name:   "profile",
+			Usage:  "use the named profile of ~/.config/token-tool/config.yaml for all flags not given on the command line or via the environment",
+			EnvVar: "TOKEN_PROFILE",
 		},
 	}
 
 	sort.Sort(cli.FlagsByName(app.Flags))
 
-	var authOpts *gophercloud.AuthOptions
-	app.Before = func(*cli.Context) (err error) {
-		if authOpts, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{AuthInfo: &authInfo}); err != nil {
-			return
+	var (
+		authenticator *tokentool.Authenticator
+		keyring       tokentool.Keyring
+	)
+	app.Before = func(c *cli.Context) (err error) {
+		if c.Args().First() != "profile" {
+			if err := applyProfile(c, c.String("profile")); err != nil {
+				return err
+			}
 		}
-		//default to system user if no user user variable set
-		if authOpts.Username == "" && authOpts.UserID == "" && authOpts.ApplicationCredentialID == "" && authOpts.ApplicationCredentialName == "" {
-			authOpts.Username = os.Getenv("USER")
+		keyring, err = keyringOpts.Keyring()
+		if err != nil {
+			return err
 		}
-		//if no domain information is given for username we default it top the scope domain name/id
-		if authOpts.Username != "" && authOpts.DomainName == "" && authOpts.DomainID == "" && authOpts.Scope != nil {
-			if authOpts.Scope.DomainID != "" {
-				authOpts.DomainID = authOpts.Scope.DomainID
-			} else {
-				authOpts.DomainName = authOpts.Scope.DomainName
-			}
+		transport.CertPassphrase = certPassphrase(keyring)
+		sources, err := passwordOptions.PasswordSources(keyring)
+		if err != nil {
+			return err
 		}
-		//try to get password from keyring if not set via env
-		if authOpts.Username != "" && authOpts.Password == "" && authOpts.ApplicationCredentialSecret == "" {
-			if pw, err := keyring.Get("openstack", authOpts.Username); err == nil {
-				log.Println("Using password from keyring")
-				authOpts.Password = pw
-			} else {
-				if term.IsTerminal(int(os.Stdin.Fd())) {
-					if password, err := gopass.GetPasswdPrompt("Password: ", true, os.Stdin, os.Stderr); err == nil {
-						authOpts.Password = string(password)
-					}
-				} else {
-					if in, err := io.ReadAll(os.Stdin); err == nil && len(in) > 0 {
-						log.Println("Password read from stdin")
-						authOpts.Password = strings.TrimRight(string(in), "\r\n")
-					}
-				}
-			}
+		authenticator = &tokentool.Authenticator{
+			Transport:         transport,
+			PasswordSources:   sources,
+			OnPasswordExpired: expiredPasswordHandler(keyring),
 		}
-
-		return
-
+		if offlineCommands[c.Args().First()] {
+			return nil
+		}
+		ec2Opts.secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		authenticator.EC2Credential, err = ec2Opts.Credential()
+		if err != nil {
+			return err
+		}
+		authenticator.AuthOptions, err = resolveAuthOptions(&authInfo)
+		return err
 	}
 
+	outputOpts := func(c *cli.Context) outputOptions {
+		k8sSecretOpts.labels = c.GlobalStringSlice("k8s-secret-label")
+		k8sSecretOpts.keys = c.GlobalStringSlice("k8s-secret-key")
+		return outputOptions{format: c.GlobalString("format"), reuse: reuseOpts, k8sSecret: k8sSecretOpts}
+	}
 	app.Action = func(c *cli.Context) error {
 		switch format := c.String("format"); format {
-		case "text", "json", "curlrc":
-			return tokenCommand(c.String("format"), authOpts, transportInfo)
+		case "text", "json", "curlrc", "exec-credential", "k8s-secret":
+			return tokenCommand(outputOpts(c), authenticator)
 		default:
-			return fmt.Errorf("unknown format given: %s", format)
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown format given: %s", format))
 		}
 	}
 	app.Commands = []cli.Command{
 		{
-			Name:  "curl",
-			Usage: "use curl with openstack credentials",
+			Name:      "curl",
+			Usage:     "use curl with openstack credentials",
+			ArgsUsage: "[--] <curl arguments>",
+			Description: "Service catalog endpoints can be referenced in the curl arguments as variables,\n" +
+				"   e.g. $COMPUTE, $OBJECT_STORE_INTERNAL or ${SWIFT} (service name alias).",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "discover-versions",
+					Usage: "query the version document of each service and add variables like $COMPUTE_V2_1",
+				},
+				cli.StringFlag{
+					Name:   "interface",
+					Value:  "public",
+					Usage:  "endpoint interface queried by --discover-versions (public, internal or admin)",
+					EnvVar: "OS_INTERFACE",
+				},
+				cli.StringSliceFlag{
+					Name:  "microversion",
+					Usage: "request a microversion, e.g. compute=2.79 (can be repeated, defaults are read from <service>_api_version in clouds.yaml)",
+				},
+				cli.BoolFlag{
+					Name:  "no-content-type",
+					Usage: "do not send the Content-Type: application/json header, e.g. for binary uploads",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return curlCommand(c.Args(), curlOptions{
+					discoverVersions: c.Bool("discover-versions"),
+					microversions:    c.StringSlice("microversion"),
+					noContentType:    c.Bool("no-content-type"),
+					region:           c.GlobalString("region"),
+					iface:            c.String("interface"),
+				}, authenticator)
+			},
+		},
+		{
+			Name:  "batch",
+			Usage: "issue tokens for many scopes at once and print them as JSON object keyed by scope",
+			Description: "Authenticates once and rescopes the token to every scope listed in the --scopes file or\n" +
+				"   given with --project. The --scopes file maps names to scopes:\n\n" +
+				"   scopes:\n" +
+				"     billing: {project_name: billing, project_domain_name: Default}\n" +
+				"     infra: {project_id: 0123456789abcdef}\n\n" +
+				"   Failed scopes carry an error object instead of a token and make the command exit non-zero.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:      "scopes",
+					Usage:     "YAML file mapping names to scopes",
+					TakesFile: true,
+				},
+				cli.StringSliceFlag{
+					Name:  "project",
+					Usage: "name of a project in the configured project domain (can be repeated)",
+				},
+				cli.IntFlag{
+					Name:  "concurrency",
+					Value: 8,
+					Usage: "maximum number of concurrent requests to keystone",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return batchCommand(batchOptions{
+					scopesFile:  c.String("scopes"),
+					projects:    c.StringSlice("project"),
+					concurrency: c.Int("concurrency"),
+				}, authenticator)
+			},
+		},
+		{
+			Name:  "watch",
+			Usage: "keep a token file fresh, e.g. on a volume shared with other containers",
+			Description: "Issues a token, atomically writes it to --output-file (mode 0600) and refreshes it after\n" +
+				"   --refresh-fraction of its lifetime has elapsed. After each rotation the process given with\n" +
+				"   --signal-pid is signaled and the --hook command is run with $TOKEN_FILE set.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:      "output-file, o",
+					Usage:     "file the token is written to",
+					TakesFile: true,
+				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Value: "text",
+					Usage: "Format: text, json, env",
+				},
+				cli.Float64Flag{
+					Name:  "refresh-fraction",
+					Value: 0.75,
+					Usage: "refresh the token after this fraction of its lifetime has elapsed",
+				},
+				cli.DurationFlag{
+					Name:  "retry-interval",
+					Value: 30 * time.Second,
+					Usage: "wait this long before retrying a failed refresh",
+				},
+				cli.IntFlag{
+					Name:  "max-failures",
+					Value: 5,
+					Usage: "exit after this many consecutive failed refreshes",
+				},
+				cli.IntFlag{
+					Name:  "signal-pid",
+					Usage: "send a signal to this process after each rotation",
+				},
+				cli.StringFlag{
+					Name:  "signal",
+					Value: "HUP",
+					Usage: "signal sent to --signal-pid: HUP, INT, TERM, USR1, USR2",
+				},
+				cli.StringFlag{
+					Name:  "hook",
+					Usage: "shell command run after each rotation",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return watchCommand(watchOptions{
+					outputFile:      c.String("output-file"),
+					format:          c.String("format"),
+					refreshFraction: c.Float64("refresh-fraction"),
+					retryInterval:   c.Duration("retry-interval"),
+					maxFailures:     c.Int("max-failures"),
+					signalPID:       c.Int("signal-pid"),
+					signal:          c.String("signal"),
+					hook:            c.String("hook"),
+				}, authenticator)
+			},
+		},
+		{
+			Name:  "ec2",
+			Usage: "manage EC2/S3 credentials of the current user, e.g. for S3 clients of Swift",
+			Subcommands: []cli.Command{
+				{
+					Name:  "create",
+					Usage: "create an EC2 credential for the current project and print it",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "format, f",
+							Value: "env",
+							Usage: "Format: env (AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY exports), json",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return ec2CreateCommand(c.String("format"), authenticator)
+					},
+				},
+				{
+					Name:  "list",
+					Usage: "list the EC2 credentials, the current project is marked with *",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "format, f",
+							Value: "text",
+							Usage: "Format: text, json (includes the secrets)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return ec2ListCommand(c.String("format"), authenticator)
+					},
+				},
+				{
+					Name:      "delete",
+					Usage:     "delete an EC2 credential",
+					ArgsUsage: "ACCESS",
+					Action: func(c *cli.Context) error {
+						return ec2DeleteCommand(c.Args().First(), authenticator)
+					},
+				},
+			},
+		},
+		{
+			Name:  "password",
+			Usage: "manage the keystone password",
+			Subcommands: []cli.Command{
+				{
+					Name:  "change",
+					Usage: "change the password (e.g. after it expired) and issue a token with the new one",
+					Action: func(c *cli.Context) error {
+						out := outputOpts(c)
+						out.reuse = reuseOptions{}
+						return passwordChangeCommand(out, keyring, authenticator)
+					},
+				},
+			},
+		},
+		{
+			Name:      "docker-credential",
+			Usage:     "docker credential helper issuing tokens for registries mapped to keystone scopes",
+			ArgsUsage: "get|store|erase|list|add REGISTRY",
+			Description: "Implements the docker credential helper protocol. Install the binary (or a symlink)\n" +
+				"   as docker-credential-token and add the registry to \"credHelpers\" in ~/.docker/config.json,\n" +
+				"   e.g. {\"credHelpers\": {\"keppel.example.com\": \"token\"}}. Do not use it as \"credsStore\",\n" +
+				"   it only handles registries accepting keystone tokens.\n" +
+				"   \"token docker-credential add REGISTRY\" maps the registry to the currently configured\n" +
+				"   keystone scope, \"docker login\" updates the mapping of registries added before.",
+			Action: func(c *cli.Context) error {
+				return dockerCredentialCommand(c.Args(), &authInfo, authenticator)
+			},
+		},
+		{
+			Name:      "git-credential",
+			Usage:     "git credential helper issuing tokens for hosts mapped to keystone scopes",
+			ArgsUsage: "get|store|erase",
+			Description: "Implements git's credential helper protocol. Hosts are mapped to keystone scopes in\n" +
+				"   ~/.config/token-tool/git-credentials.yaml. Configure it with:\n" +
+				"   git config --global credential.https://git.example.com.helper '!token git-credential'",
 			Action: func(c *cli.Context) error {
-				return curlCommand(c.Args(), authOpts, transportInfo)
+				return gitCredentialCommand(c.Args().First(), &authInfo, authenticator)
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "share the configuration of this tool with other OpenStack clients",
+			Subcommands: []cli.Command{
+				{
+					Name:  "export",
+					Usage: "print an openrc file or clouds.yaml entry matching the current settings",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "format, f",
+							Value: "openrc",
+							Usage: "Format: openrc, clouds-yaml",
+						},
+						cli.StringFlag{
+							Name:  "cloud-name",
+							Value: "openstack",
+							Usage: "name of the cloud entry in clouds.yaml",
+						},
+						cli.BoolFlag{
+							Name:  "include-secrets",
+							Usage: "include the password or application credential secret",
+						},
+						cli.BoolFlag{
+							Name:  "token",
+							Usage: "issue a token and export it (auth_type: v3token) instead of the credentials",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return configExportCommand(exportOptions{
+							format:         c.String("format"),
+							cloudName:      c.String("cloud-name"),
+							includeSecrets: c.Bool("include-secrets"),
+							useToken:       c.Bool("token"),
+						}, authenticator)
+					},
+				},
+			},
+		},
+		{
+			Name:  "profile",
+			Usage: "manage the profiles in ~/.config/token-tool/config.yaml",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "list all profiles, the default profile is marked with *",
+					Action: func(c *cli.Context) error {
+						return profileListCommand()
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "print the settings of a profile",
+					ArgsUsage: "[NAME]",
+					Action: func(c *cli.Context) error {
+						return profileShowCommand(c.Args().First())
+					},
+				},
+				{
+					Name:        "set",
+					Usage:       "create or update a profile, an empty value removes the key",
+					ArgsUsage:   "NAME [key=value...]",
+					Description: "Valid keys: " + strings.Join(sortedProfileKeys(), ", "),
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "default",
+							Usage: "make this the default profile",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return profileSetCommand(c.Args().First(), c.Args().Tail(), c.Bool("default"))
+					},
+				},
+				{
+					Name:      "delete",
+					Usage:     "delete a profile",
+					ArgsUsage: "NAME",
+					Action: func(c *cli.Context) error {
+						return profileDeleteCommand(c.Args().First())
+					},
+				},
+			},
+		},
+		{
+			Name:  "keyring",
+			Usage: "manage secrets in the keyring selected with --keyring-backend",
+			Subcommands: []cli.Command{
+				{
+					Name:      "set",
+					Usage:     "store a secret read from the terminal or stdin, e.g. the password of USER",
+					ArgsUsage: "USER",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "service",
+							Value: "openstack",
+							Usage: "keyring service, \"openstack-cert\" for certificate passphrases (USER is the absolute path of the certificate)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return keyringSetCommand(keyring, c.String("service"), c.Args().First())
+					},
+				},
+				{
+					Name:      "delete",
+					Usage:     "delete a secret",
+					ArgsUsage: "USER",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "service",
+							Value: "openstack",
+							Usage: "keyring service",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return keyringDeleteCommand(keyring, c.String("service"), c.Args().First())
+					},
+				},
+				{
+					Name:  "lock",
+					Usage: "lock the file keyring, so that the passphrase is asked for again",
+					Action: func(c *cli.Context) error {
+						return keyringLockCommand(keyringOpts)
+					},
+				},
+			},
+		},
+		{
+			Name:  "cert",
+			Usage: "inspect the configured 2FA client certificate",
+			Subcommands: []cli.Command{
+				{
+					Name:  "info",
+					Usage: "print subject, issuer, SANs, serial, key type and validity of the client certificate",
+					Action: func(c *cli.Context) error {
+						return certInfoCommand(transport)
+					},
+				},
 			},
 		},
 	}
 
-	err := app.Run(os.Args)
+	args := os.Args
+	//when installed as docker-credential-token, act as docker credential helper
+	if filepath.Base(args[0]) == "docker-credential-token" {
+		args = append([]string{args[0], "docker-credential"}, args[1:]...)
+	}
+	err := app.Run(args)
 	if err != nil {
-		log.Fatal(err)
+		os.Exit(reportError(err, errorFormat))
 	}
 
 }
 
-func makeProviderClient(authOptions *gophercloud.AuthOptions, transportInfo transportInfo) (*gophercloud.ProviderClient, error) {
-	providerClient, err := openstack.NewClient(authOptions.IdentityEndpoint)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create OpenStack client: %s", err)
-	}
-	err = transportInfo.InjectIfConfigured(providerClient)
-	if err != nil {
-		return nil, fmt.Errorf("failed to inject 2FA certs into OpenStack client: %w", err)
-	}
-	err = openstack.Authenticate(providerClient, *authOptions)
-	if err != nil {
-		return nil, fmt.Errorf("failed to authenticate: %w", err)
-	}
-	return providerClient, nil
+// outputOptions select how tokenCommand prints the token.
+type outputOptions struct {
+	format    string
+	reuse     reuseOptions
+	k8sSecret k8sSecretOptions
 }
 
-func tokenCommand(format string, authOptions *gophercloud.AuthOptions, transportInfo transportInfo) error {
-	providerClient, err := makeProviderClient(authOptions, transportInfo)
-	if err != nil {
-		return err
-	}
-	tokenResponse, ok := providerClient.GetAuthResult().(tokens.CreateResult)
-	if !ok {
-		return errors.New("auth response is not a v3 response")
-	}
-
-	switch format {
+func tokenCommand(out outputOptions, a *tokentool.Authenticator) error {
+	var formatter tokentool.Formatter
+	switch out.format {
+	case "exec-credential":
+		if out.reuse.path != "" {
+			return tokentool.WithKind(tokentool.KindConfiguration, errors.New("--reuse-file cannot be used with the exec-credential format, which caches credentials itself"))
+		}
+		return execCredentialCommand(a)
+	case "k8s-secret":
+		k8sSecret, err := out.k8sSecret.Formatter()
+		if err != nil {
+			return err
+		}
+		formatter = k8sSecret
 	case "curlrc":
-		fmt.Printf("header \"X-Auth-Token: %s\"\n", providerClient.Token())
-		fmt.Printf("header \"Content-Type: application/json\"\n")
+		formatter = tokentool.CurlrcFormatter{}
 	case "json":
-		//add the token from the heder to the nested json as token_id
-		b := tokenResponse.Body.(map[string]interface{})
-		b["token_id"] = providerClient.Token()
-		e := json.NewEncoder(os.Stdout)
-		e.SetIndent("", "  ")
-		return e.Encode(b)
+		formatter = tokentool.JSONFormatter{}
 	default:
-		fmt.Println(providerClient.Token())
+		formatter = tokentool.TextFormatter{}
 	}
 
-	return nil
-}
-
-func curlCommand(curlArgs []string, authOptions *gophercloud.AuthOptions, transportInfo transportInfo) error {
-	curlPath, err := exec.LookPath("curl")
-	if err != nil {
-		return fmt.Errorf("curl command not found in path: %s", err)
-	}
-
-	providerClient, err := makeProviderClient(authOptions, transportInfo)
-	if err != nil {
-		return fmt.Errorf("failed to authenticate: %s", err)
-	}
-	tokenResponse, ok := providerClient.GetAuthResult().(tokens.CreateResult)
-	if !ok {
-		return errors.New("auth response is not a v3 response")
-	}
-
-	catalog, err := tokenResponse.ExtractServiceCatalog()
+	token, err := issueOrReuseToken(out.reuse, a)
 	if err != nil {
-		return fmt.Errorf("failed to get catalog from auth response: %s", err)
-	}
-
-	vars := map[string]string{}
-	for _, entry := range catalog.Entries {
-		for _, ep := range entry.Endpoints {
-			vars[strings.ToUpper(entry.Type)+"_"+strings.ToUpper(ep.Interface)] = ep.URL
-			if ep.Interface == "public" {
-				vars[strings.ToUpper(entry.Type)] = ep.URL
-			}
-		}
-	}
-	for i, arg := range curlArgs {
-		curlArgs[i] = os.Expand(arg, func(s string) string { return vars[s] })
+		return err
 	}
-
-	log.Println("curl", strings.Join(curlArgs, " "))
-	curlArgs = append([]string{
-		curlPath,
-		"--header", "X-Auth-Token: " + providerClient.Token(),
-		"--header", "Content-Type: application/json",
-	},
-		curlArgs...)
-
-	return syscall.Exec(curlPath, curlArgs, os.Environ())
-
+	return formatter.Format(os.Stdout, token)
 }
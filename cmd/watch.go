@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+type watchOptions struct {
+	outputFile      string
+	format          string
+	refreshFraction float64
+	retryInterval   time.Duration
+	maxFailures     int
+	signalPID       int
+	signal          string
+	hook            string
+}
+
+// watchCommand keeps the token in outputFile fresh until it is interrupted or
+// maxFailures consecutive refreshes failed.
+func watchCommand(opts watchOptions, a *tokentool.Authenticator) error {
+	if opts.outputFile == "" {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("usage: token watch --output-file PATH"))
+	}
+	var formatter tokentool.Formatter
+	switch opts.format {
+	case "text":
+		formatter = tokentool.TextFormatter{}
+	case "json":
+		formatter = tokentool.JSONFormatter{}
+	case "env":
+		formatter = tokentool.EnvFormatter{AuthURL: a.AuthOptions.IdentityEndpoint}
+	default:
+		return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown format given: %s, expected text, json or env", opts.format))
+	}
+	if opts.refreshFraction <= 0 || opts.refreshFraction >= 1 {
+		return tokentool.WithKind(tokentool.KindConfiguration, errors.New("--refresh-fraction must be between 0 and 1"))
+	}
+	var sig syscall.Signal
+	if opts.signalPID != 0 {
+		var ok bool
+		sig, ok = watchSignals[strings.TrimPrefix(strings.ToUpper(opts.signal), "SIG")]
+		if !ok {
+			return tokentool.WithKind(tokentool.KindConfiguration, fmt.Errorf("unknown signal %q, expected HUP, INT, TERM, USR1 or USR2", opts.signal))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failures := 0
+	for {
+		token, err := writeWatchedToken(opts.outputFile, formatter, a)
+		var wait time.Duration
+		if err != nil {
+			if !transientError(err) {
+				return err
+			}
+			failures++
+			if failures >= opts.maxFailures {
+				return fmt.Errorf("giving up after %d failed refreshes: %w", failures, err)
+			}
+			log.Printf("WARNING: failed to refresh token (%d/%d failures): %s", failures, opts.maxFailures, err)
+			wait = opts.retryInterval
+		} else {
+			failures = 0
+			//the remaining lifetime at issue time approximates the token lifetime
+			wait = time.Duration(float64(token.ExpiresIn()) * opts.refreshFraction)
+			if wait < time.Second {
+				wait = time.Second
+			}
+			log.Printf("Wrote token to %s, it expires at %s, refreshing in %s",
+				opts.outputFile, token.ExpiresAt.Local().Format(time.RFC3339), wait.Truncate(time.Second))
+			notifyRotation(opts, sig)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Stopped watching the token")
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// transientError reports whether a failed refresh may succeed when retried: network
+// errors, failed TLS handshakes, rate limiting, server errors and failures to write
+// the output file, e.g. because the volume is full. Other errors, like invalid
+// credentials, a locked account or an expired password, need intervention.
+func transientError(err error) bool {
+	var we writeError
+	if errors.As(err, &we) {
+		return true
+	}
+	switch tokentool.ClassifyError(err) {
+	case tokentool.KindNetwork:
+		return true
+	case tokentool.KindTLS:
+		//certificates that are invalid or expired stay so
+		var (
+			te          tokentool.Error
+			unknownCA   x509.UnknownAuthorityError
+			hostname    x509.HostnameError
+			invalidCert x509.CertificateInvalidError
+		)
+		return !errors.As(err, &te) && !errors.As(err, &unknownCA) && !errors.As(err, &hostname) && !errors.As(err, &invalidCert)
+	case tokentool.KindGeneric:
+		resp, ok := tokentool.UnexpectedResponse(err)
+		return ok && (resp.Actual == http.StatusTooManyRequests || resp.Actual >= 500)
+	}
+	return false
+}
+
+// writeError marks a failure to write the output file.
+type writeError struct {
+	err error
+}
+
+func (e writeError) Error() string {
+	return "failed to write token file: " + e.err.Error()
+}
+
+func (e writeError) Unwrap() error {
+	return e.err
+}
+
+// writeWatchedToken issues a token and atomically replaces path with it.
+func writeWatchedToken(path string, formatter tokentool.Formatter, a *tokentool.Authenticator) (*tokentool.Token, error) {
+	token, err := a.Authenticate()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, token); err != nil {
+		return nil, err
+	}
+	if err := tokentool.WriteFileAtomic(path, buf.Bytes(), 0600); err != nil {
+		return nil, writeError{err}
+	}
+	return token, nil
+}
+
+// signalProcess sends sig to the process with the given PID.
+func signalProcess(pid int, sig syscall.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
+
+// notifyRotation sends the configured signal and runs the hook command after the
+// token file was replaced. Failures are logged, but do not stop the watch.
+func notifyRotation(opts watchOptions, sig syscall.Signal) {
+	if opts.signalPID != 0 {
+		if err := signalProcess(opts.signalPID, sig); err != nil {
+			log.Printf("WARNING: failed to send %s to process %d: %s", sig, opts.signalPID, err)
+		}
+	}
+	if opts.hook != "" {
+		cmd := exec.Command("/bin/sh", "-c", opts.hook)
+		cmd.Env = append(os.Environ(), "TOKEN_FILE="+opts.outputFile)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			log.Printf("WARNING: hook command failed: %s", err)
+		}
+	}
+}
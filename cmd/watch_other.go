@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "syscall"
+
+// watchSignals are the signals that can be sent to another process after a rotation.
+// Sending them fails on platforms that can only kill processes, which is logged.
+var watchSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/sapcc/token-tool/pkg/tokentool"
+)
+
+func keystoneResponse(code int, message string) gophercloud.ErrUnexpectedResponseCode {
+	return gophercloud.ErrUnexpectedResponseCode{
+		Actual: code,
+		Body:   []byte(fmt.Sprintf(`{"error":{"code":%d,"message":%q}}`, code, message)),
+	}
+}
+
+func TestTransientError(t *testing.T) {
+	cases := []struct {
+		err       error
+		transient bool
+	}{
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{&net.DNSError{Err: "no such host", Name: "keystone.example.com"}, true},
+		{errors.New("remote error: tls: handshake failure"), true},
+		{gophercloud.ErrDefault500{ErrUnexpectedResponseCode: keystoneResponse(500, "Internal error.")}, true},
+		{gophercloud.ErrDefault503{ErrUnexpectedResponseCode: keystoneResponse(503, "Unavailable.")}, true},
+		{keystoneResponse(502, "Bad gateway."), true},
+		{gophercloud.ErrDefault429{ErrUnexpectedResponseCode: keystoneResponse(429, "Too many requests.")}, true},
+		{writeError{errors.New("no space left on device")}, true},
+
+		{gophercloud.ErrDefault401{ErrUnexpectedResponseCode: keystoneResponse(401, "The request you have made requires authentication.")}, false},
+		{gophercloud.ErrDefault401{ErrUnexpectedResponseCode: keystoneResponse(401, "The account is locked for user: u.")}, false},
+		{gophercloud.ErrDefault401{ErrUnexpectedResponseCode: keystoneResponse(401, "The password is expired and needs to be changed for user: u.")}, false},
+		{gophercloud.ErrDefault404{ErrUnexpectedResponseCode: keystoneResponse(404, "Could not find project: p.")}, false},
+		{gophercloud.ErrDefault400{ErrUnexpectedResponseCode: keystoneResponse(400, "Invalid input.")}, false},
+		{x509.UnknownAuthorityError{}, false},
+		{tokentool.WithKind(tokentool.KindTLS, errors.New("client certificate expired")), false},
+		{tokentool.WithKind(tokentool.KindConfiguration, errors.New("no password")), false},
+		{errors.New("unknown format given: yaml"), false},
+	}
+	for _, c := range cases {
+		if transient := transientError(c.err); transient != c.transient {
+			t.Errorf("transientError(%v) = %t, expected %t", c.err, transient, c.transient)
+		}
+	}
+}
+
+func TestWatchStopsOnInvalidCredentials(t *testing.T) {
+	calls := 0
+	a := &tokentool.Authenticator{
+		AuthOptions: &gophercloud.AuthOptions{Username: "alice"},
+		PasswordSources: []tokentool.PasswordSource{tokentool.PasswordSourceFunc(func(*gophercloud.AuthOptions) (string, error) {
+			calls++
+			return "", tokentool.WithKind(tokentool.KindInvalidCredentials, errors.New("wrong password"))
+		})},
+	}
+	opts := watchOptions{
+		outputFile:      t.TempDir() + "/token",
+		format:          "text",
+		refreshFraction: 0.75,
+		retryInterval:   time.Hour,
+		maxFailures:     5,
+	}
+	err := watchCommand(opts, a)
+	if tokentool.ClassifyError(err) != tokentool.KindInvalidCredentials {
+		t.Errorf("got %v, expected invalid_credentials", err)
+	}
+	if calls != 1 {
+		t.Errorf("authentication was attempted %d times, expected once", calls)
+	}
+}
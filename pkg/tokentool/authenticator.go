@@ -0,0 +1,265 @@
+// Package tokentool issues keystone tokens the same way as the token CLI: it
+// resolves credentials from the environment, clouds.yaml and pluggable password
+// sources, authenticates over a configurable HTTP transport (2FA client
+// certificates, retries, debug tracing) and formats the resulting tokens.
+//
+// Profiles, configuration export, batch issuance, watch mode and the
+// exec-credential cache are features of the token CLI and not part of this package.
+package tokentool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/extensions/ec2tokens"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/users"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+// Version is reported as creator of HAR files.
+var Version = "HEAD"
+
+// expiredUserIDRx extracts the user ID from keystone's "The password is expired and
+// needs to be changed for user: <id>." message.
+var expiredUserIDRx = regexp.MustCompile(`for user: ([^\s.]+)`)
+
+// Authenticator issues keystone tokens for AuthOptions.
+type Authenticator struct {
+	AuthOptions *gophercloud.AuthOptions
+	Transport   Transport
+	//PasswordSources are asked in order for the password or application
+	//credential secret if AuthOptions does not contain it.
+	PasswordSources []PasswordSource
+	//OnPasswordExpired is called when keystone rejects the password as expired. If
+	//it returns nil (e.g. after calling ChangePassword), authentication is retried.
+	OnPasswordExpired func(a *Authenticator, err error) error
+	//EC2Credential, if set, is used to authenticate instead of the credentials in
+	//AuthOptions, which then only provide the identity endpoint.
+	EC2Credential *EC2Credential
+}
+
+// EC2Credential is an EC2/S3 style access and secret key pair. Tokens issued with it
+// are scoped to the project the credential belongs to.
+type EC2Credential struct {
+	Access string
+	Secret string
+}
+
+// Token is an issued keystone token.
+type Token struct {
+	ID        string
+	ExpiresAt time.Time
+	//Result is the response of the token request. It is empty for tokens that were
+	//not just issued, e.g. read from a cache.
+	Result tokens.CreateResult
+	//ProviderClient is authenticated with the token.
+	ProviderClient *gophercloud.ProviderClient
+}
+
+// ResolveAuthOptions builds the auth options from authInfo, the OS_* environment
+// variables and clouds.yaml. Passwords are resolved separately by the password
+// sources of the Authenticator.
+func ResolveAuthOptions(authInfo *clientconfig.AuthInfo) (*gophercloud.AuthOptions, error) {
+	authOpts, err := clientconfig.AuthOptions(&clientconfig.ClientOpts{AuthInfo: authInfo})
+	if err != nil {
+		return nil, WithKind(KindConfiguration, err)
+	}
+	//default to system user if no user user variable set
+	if authOpts.Username == "" && authOpts.UserID == "" && authOpts.ApplicationCredentialID == "" && authOpts.ApplicationCredentialName == "" {
+		authOpts.Username = os.Getenv("USER")
+	}
+	//if no domain information is given for username we default it top the scope domain name/id
+	if authOpts.Username != "" && authOpts.DomainName == "" && authOpts.DomainID == "" && authOpts.Scope != nil {
+		if authOpts.Scope.DomainID != "" {
+			authOpts.DomainID = authOpts.Scope.DomainID
+		} else {
+			authOpts.DomainName = authOpts.Scope.DomainName
+		}
+	}
+	return authOpts, nil
+}
+
+// ResolvePassword fills in the password from the password sources if it is needed
+// and not known yet.
+func (a *Authenticator) ResolvePassword() error {
+	return ResolvePassword(a.AuthOptions, a.PasswordSources...)
+}
+
+// NewProviderClient creates an unauthenticated provider client using the HTTP client
+// built from the transport settings.
+func (a *Authenticator) NewProviderClient() (*gophercloud.ProviderClient, error) {
+	providerClient, err := openstack.NewClient(a.AuthOptions.IdentityEndpoint)
+	if err != nil {
+		return nil, WithKind(KindConfiguration, fmt.Errorf("failed to create OpenStack client: %w", err))
+	}
+	err = a.Transport.Inject(providerClient)
+	if err != nil {
+		return nil, WithKind(KindConfiguration, fmt.Errorf("failed to configure HTTP client: %w", err))
+	}
+	return providerClient, nil
+}
+
+// Authenticate resolves the password if needed and issues a token.
+func (a *Authenticator) Authenticate() (*Token, error) {
+	if a.EC2Credential != nil {
+		return a.authenticateEC2()
+	}
+	if err := a.ResolvePassword(); err != nil {
+		return nil, err
+	}
+	providerClient, err := a.NewProviderClient()
+	if err != nil {
+		return nil, err
+	}
+	err = openstack.Authenticate(providerClient, *a.AuthOptions)
+	if err != nil && ClassifyError(err) == KindPasswordExpired && a.OnPasswordExpired != nil {
+		err = a.OnPasswordExpired(a, err)
+		if err == nil {
+			err = openstack.Authenticate(providerClient, *a.AuthOptions)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	return extractToken(providerClient)
+}
+
+// authenticateEC2 issues a token with a signature made with the EC2 secret key, so
+// that the secret itself is never sent to keystone.
+func (a *Authenticator) authenticateEC2() (*Token, error) {
+	providerClient, err := a.NewProviderClient()
+	if err != nil {
+		return nil, err
+	}
+	err = openstack.AuthenticateV3(providerClient, &ec2tokens.AuthOptions{
+		Access: a.EC2Credential.Access,
+		Secret: a.EC2Credential.Secret,
+	}, gophercloud.EndpointOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with EC2 credential: %w", err)
+	}
+	return extractToken(providerClient)
+}
+
+// Rescope issues a token for scope based on token, e.g. to obtain tokens for many
+// projects with a single password authentication. The HTTP client of the token's
+// ProviderClient is shared, so that client certificates are loaded only once. It is
+// safe for concurrent use.
+func (a *Authenticator) Rescope(token *Token, scope *gophercloud.AuthScope) (*Token, error) {
+	var providerClient *gophercloud.ProviderClient
+	var err error
+	if token.ProviderClient != nil {
+		providerClient, err = openstack.NewClient(a.AuthOptions.IdentityEndpoint)
+		if err != nil {
+			return nil, WithKind(KindConfiguration, fmt.Errorf("failed to create OpenStack client: %w", err))
+		}
+		providerClient.HTTPClient = token.ProviderClient.HTTPClient
+	} else {
+		providerClient, err = a.NewProviderClient()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = openstack.Authenticate(providerClient, gophercloud.AuthOptions{
+		IdentityEndpoint: a.AuthOptions.IdentityEndpoint,
+		TokenID:          token.ID,
+		Scope:            scope,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rescope token: %w", err)
+	}
+	return extractToken(providerClient)
+}
+
+// extractToken returns the token providerClient was authenticated with.
+func extractToken(providerClient *gophercloud.ProviderClient) (*Token, error) {
+	tokenResponse, ok := providerClient.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return nil, errors.New("auth response is not a v3 response")
+	}
+	token, err := tokenResponse.ExtractToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token from auth response: %w", err)
+	}
+	return &Token{
+		ID:             providerClient.Token(),
+		ExpiresAt:      token.ExpiresAt,
+		Result:         tokenResponse,
+		ProviderClient: providerClient,
+	}, nil
+}
+
+// ChangePassword changes the password of the user in keystone. AuthOptions.Password
+// must hold the current password and is replaced with the new one.
+func (a *Authenticator) ChangePassword(newPassword string) error {
+	if a.AuthOptions.Password == "" {
+		return WithKind(KindConfiguration, errors.New("the current password is required to change it"))
+	}
+	if newPassword == "" {
+		return WithKind(KindConfiguration, errors.New("the new password must not be empty"))
+	}
+
+	providerClient, err := a.NewProviderClient()
+	if err != nil {
+		return err
+	}
+	userID, err := a.passwordUserID(providerClient)
+	if err != nil {
+		return err
+	}
+
+	identityClient, err := openstack.NewIdentityV3(providerClient, gophercloud.EndpointOpts{})
+	if err != nil {
+		return fmt.Errorf("failed to create identity client: %w", err)
+	}
+	err = users.ChangePassword(identityClient, userID, users.ChangePasswordOpts{
+		OriginalPassword: a.AuthOptions.Password,
+		Password:         newPassword,
+	}).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+
+	a.AuthOptions.Password = newPassword
+	return nil
+}
+
+// passwordUserID determines the ID of the user whose password is changed. If it is
+// not configured, the user is looked up by authenticating with the current password,
+// which for an expired password yields the ID in the error message.
+func (a *Authenticator) passwordUserID(providerClient *gophercloud.ProviderClient) (string, error) {
+	if a.AuthOptions.UserID != "" {
+		return a.AuthOptions.UserID, nil
+	}
+
+	//authenticate without scope, the password change does not need one
+	opts := *a.AuthOptions
+	opts.Scope = nil
+	opts.TenantID, opts.TenantName = "", ""
+	err := openstack.Authenticate(providerClient, opts)
+	if err == nil {
+		tokenResponse, ok := providerClient.GetAuthResult().(tokens.CreateResult)
+		if !ok {
+			return "", errors.New("auth response is not a v3 response")
+		}
+		user, err := tokenResponse.ExtractUser()
+		if err != nil {
+			return "", fmt.Errorf("failed to get user from auth response: %w", err)
+		}
+		return user.ID, nil
+	}
+	if ClassifyError(err) == KindPasswordExpired {
+		if resp, ok := UnexpectedResponse(err); ok {
+			if m := expiredUserIDRx.FindStringSubmatch(KeystoneErrorMessage(resp.Body)); m != nil {
+				return m[1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("failed to determine user ID, set it explicitly: %w", err)
+}
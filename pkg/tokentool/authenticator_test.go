@@ -0,0 +1,150 @@
+package tokentool
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keystone := newTestKeystone(t)
+	t.Setenv("TEST_PASSWORD", "secret")
+	a := keystone.authenticator()
+	a.PasswordSources = []PasswordSource{EnvSource{Variable: "TEST_PASSWORD"}}
+
+	token, err := a.Authenticate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token.ID, "token-demo-") {
+		t.Errorf("unexpected token ID %q", token.ID)
+	}
+	if token.ExpiresIn() <= 0 {
+		t.Errorf("token expires at %s, expected it in the future", token.ExpiresAt)
+	}
+	if token.ProviderClient == nil || token.ProviderClient.Token() != token.ID {
+		t.Error("the provider client is not authenticated with the token")
+	}
+	if a.AuthOptions.Password != "secret" {
+		t.Error("the password was not resolved from the password sources")
+	}
+}
+
+func TestAuthenticateInvalidCredentials(t *testing.T) {
+	keystone := newTestKeystone(t)
+	a := keystone.authenticator()
+	a.AuthOptions.Password = "wrong"
+
+	_, err := a.Authenticate()
+	if kind := ClassifyError(err); kind != KindInvalidCredentials {
+		t.Errorf("got %s (%v), expected invalid_credentials", kind, err)
+	}
+}
+
+func TestAuthenticateExpiredPassword(t *testing.T) {
+	keystone := newTestKeystone(t)
+	keystone.expired = true
+
+	a := keystone.authenticator()
+	a.AuthOptions.Password = "secret"
+	_, err := a.Authenticate()
+	if kind := ClassifyError(err); kind != KindPasswordExpired {
+		t.Fatalf("got %s (%v) without OnPasswordExpired, expected password_expired", kind, err)
+	}
+
+	called := false
+	a.OnPasswordExpired = func(a *Authenticator, err error) error {
+		called = true
+		return a.ChangePassword("new-secret")
+	}
+	token, err := a.Authenticate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called || token.ID == "" {
+		t.Error("authentication was not retried after the password change")
+	}
+	if keystone.password != "new-secret" || a.AuthOptions.Password != "new-secret" {
+		t.Error("the password was not changed")
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	keystone := newTestKeystone(t)
+	a := keystone.authenticator()
+
+	if err := a.ChangePassword("new-secret"); ClassifyError(err) != KindConfiguration {
+		t.Errorf("changing the password without the current one: got %v, expected a configuration error", err)
+	}
+	a.AuthOptions.Password = "secret"
+	if err := a.ChangePassword(""); ClassifyError(err) != KindConfiguration {
+		t.Errorf("changing to an empty password: got %v, expected a configuration error", err)
+	}
+
+	//the user ID is looked up with the current password
+	if err := a.ChangePassword("new-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if keystone.password != "new-secret" || a.AuthOptions.Password != "new-secret" {
+		t.Error("the password was not changed")
+	}
+
+	a.AuthOptions.Password = "wrong"
+	a.AuthOptions.UserID = "user-alice"
+	if err := a.ChangePassword("other"); err == nil {
+		t.Error("expected the password change with a wrong current password to fail")
+	}
+}
+
+func TestRescope(t *testing.T) {
+	keystone := newTestKeystone(t)
+	a := keystone.authenticator()
+	a.AuthOptions.Password = "secret"
+	token, err := a.Authenticate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scoped, err := a.Rescope(token, &gophercloud.AuthScope{ProjectName: "reporting", DomainName: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := scoped.Result.ExtractProject()
+	if err != nil || project == nil || project.Name != "reporting" {
+		t.Errorf("rescoped token has project %v (%v), expected reporting", project, err)
+	}
+	if scoped.ID == token.ID {
+		t.Error("rescoping did not issue a new token")
+	}
+
+	_, err = a.Rescope(token, &gophercloud.AuthScope{ProjectName: "forbidden", DomainName: "Default"})
+	if kind := ClassifyError(err); kind != KindScopeNotFound {
+		t.Errorf("got %s (%v), expected scope_not_found", kind, err)
+	}
+
+	//tokens read from a file have no provider client
+	fromFile := &Token{ID: token.ID, ExpiresAt: token.ExpiresAt}
+	if _, err := a.Rescope(fromFile, &gophercloud.AuthScope{ProjectName: "other", DomainName: "Default"}); err != nil {
+		t.Error(err)
+	}
+	if _, err := a.Rescope(&Token{ID: "invalid"}, &gophercloud.AuthScope{ProjectName: "other", DomainName: "Default"}); err == nil {
+		t.Error("expected rescoping an invalid token to fail")
+	}
+}
+
+func TestAuthenticatePasswordSourceError(t *testing.T) {
+	keystone := newTestKeystone(t)
+	a := keystone.authenticator()
+	sourceErr := WithKind(KindConfiguration, errors.New("no password"))
+	a.PasswordSources = []PasswordSource{PasswordSourceFunc(func(*gophercloud.AuthOptions) (string, error) {
+		return "", sourceErr
+	})}
+	if _, err := a.Authenticate(); !errors.Is(err, sourceErr) {
+		t.Errorf("got %v, expected the error of the password source", err)
+	}
+	if keystone.issued != 0 {
+		t.Error("keystone was called although no password is available")
+	}
+}
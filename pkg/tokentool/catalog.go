@@ -0,0 +1,285 @@
+package tokentool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/gophercloud/openstack/utils"
+)
+
+// CatalogVars builds the variables available for expansion in curl arguments.
+// For every endpoint the following names are set:
+//
+//	TYPE_INTERFACE, e.g. OBJECT_STORE_INTERNAL
+//	TYPE for the public interface, e.g. OBJECT_STORE
+//	NAME_INTERFACE and NAME as aliases based on the service name, e.g. SWIFT
+//
+// Names are upper cased and every character that is not valid in a shell variable
+// name is replaced by an underscore. The raw upper cased type (e.g. OBJECT-STORE) is
+// kept for backwards compatibility. Type based names always take precedence over name
+// based aliases, and the first service registered for a given type wins. If region is
+// not empty, endpoints of other regions are ignored.
+func CatalogVars(catalog *tokens.ServiceCatalog, region string) map[string]string {
+	vars := map[string]string{}
+	setOnce := func(key, value string) {
+		if _, exists := vars[key]; !exists {
+			vars[key] = value
+		}
+	}
+
+	inRegion := func(ep tokens.Endpoint) bool {
+		return region == "" || ep.Region == region || ep.RegionID == region
+	}
+
+	for _, entry := range catalog.Entries {
+		for _, ep := range entry.Endpoints {
+			if !inRegion(ep) {
+				continue
+			}
+			iface := normalizeVarName(ep.Interface)
+			for _, prefix := range uniqueStrings(strings.ToUpper(entry.Type), normalizeVarName(entry.Type)) {
+				setOnce(prefix+"_"+iface, ep.URL)
+				if ep.Interface == "public" {
+					setOnce(prefix, ep.URL)
+				}
+			}
+		}
+	}
+	for _, entry := range catalog.Entries {
+		if entry.Name == "" {
+			continue
+		}
+		prefix := normalizeVarName(entry.Name)
+		for _, ep := range entry.Endpoints {
+			if !inRegion(ep) {
+				continue
+			}
+			setOnce(prefix+"_"+normalizeVarName(ep.Interface), ep.URL)
+			if ep.Interface == "public" {
+				setOnce(prefix, ep.URL)
+			}
+		}
+	}
+
+	return vars
+}
+
+// DefaultDiscoveryTimeout bounds the version discovery of all endpoints.
+const DefaultDiscoveryTimeout = 5 * time.Second
+
+// VersionDiscoveryOpts selects the endpoints probed by DiscoverVersionVars.
+type VersionDiscoveryOpts struct {
+	//Region limits the discovery to endpoints of this region if not empty.
+	Region string
+	//Interface defaults to "public".
+	Interface string
+	//Timeout defaults to DefaultDiscoveryTimeout.
+	Timeout time.Duration
+}
+
+// DiscoverVersionVars queries the version documents of the endpoints of the selected
+// interface and adds a variable per advertised API version, e.g. COMPUTE_V2_1 or,
+// for other interfaces than public, COMPUTE_INTERNAL_V2_1. The variables point to
+// the self link of the version. The endpoints are queried concurrently and failures
+// are logged and otherwise ignored because many services do not publish a version
+// document at all. Like in CatalogVars, type based names take precedence over name
+// based aliases and existing variables are not replaced.
+func DiscoverVersionVars(provider *gophercloud.ProviderClient, catalog *tokens.ServiceCatalog, opts VersionDiscoveryOpts, vars map[string]string) {
+	//OS_INTERFACE can also be given in the v2 style, e.g. internalURL
+	iface := strings.TrimSuffix(opts.Interface, "URL")
+	if iface == "" {
+		iface = "public"
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDiscoveryTimeout
+	}
+
+	//the endpoints to probe in the order of precedence, each base URL is queried once
+	type probe struct {
+		prefix string
+		base   string
+	}
+	var (
+		probes []probe
+		bases  []string
+	)
+	seen := map[string]bool{}
+	addProbe := func(prefix string, ep tokens.Endpoint) {
+		if ep.Interface != iface || (opts.Region != "" && ep.Region != opts.Region && ep.RegionID != opts.Region) {
+			return
+		}
+		base, err := utils.BaseEndpoint(ep.URL)
+		if err != nil {
+			return
+		}
+		base = strings.TrimSuffix(base, "/")
+		probes = append(probes, probe{prefix, base})
+		if !seen[base] {
+			seen[base] = true
+			bases = append(bases, base)
+		}
+	}
+	for _, entry := range catalog.Entries {
+		for _, ep := range entry.Endpoints {
+			addProbe(normalizeVarName(entry.Type), ep)
+		}
+	}
+	for _, entry := range catalog.Entries {
+		if entry.Name != "" {
+			for _, ep := range entry.Endpoints {
+				addProbe(normalizeVarName(entry.Name), ep)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	//every goroutine writes only its own slot of results
+	results := make([][]versionLink, len(bases))
+	var wg sync.WaitGroup
+	for i, base := range bases {
+		wg.Add(1)
+		go func(i int, base string) {
+			defer wg.Done()
+			versions, err := fetchVersions(ctx, provider, base+"/")
+			if err != nil {
+				log.Printf("version discovery for %s failed: %s", base, err)
+				return
+			}
+			results[i] = versions
+		}(i, base)
+	}
+	wg.Wait()
+	versionsByBase := make(map[string][]versionLink, len(bases))
+	for i, base := range bases {
+		versionsByBase[base] = results[i]
+	}
+
+	setOnce := func(key, value string) {
+		if _, exists := vars[key]; !exists {
+			vars[key] = value
+		}
+	}
+	for _, p := range probes {
+		for _, v := range versionsByBase[p.base] {
+			version := normalizeVarName(v.ID)
+			setOnce(p.prefix+"_"+normalizeVarName(iface)+"_"+version, v.URL)
+			if iface == "public" {
+				setOnce(p.prefix+"_"+version, v.URL)
+			}
+		}
+	}
+}
+
+// versionLink is an API version advertised in a version document.
+type versionLink struct {
+	ID  string
+	URL string
+}
+
+// fetchVersions returns all versions listed in the version document found at url.
+// Both the list form ({"versions": [...]}), the keystone form
+// ({"versions": {"values": [...]}}) and the single version form ({"version": {...}})
+// are understood. The URL of a version is its self link, relative links are resolved
+// against url. Versions without self link are assumed to live below url.
+func fetchVersions(ctx context.Context, provider *gophercloud.ProviderClient, url string) ([]versionLink, error) {
+	type version struct {
+		ID    string `json:"id"`
+		Links []struct {
+			Rel  string `json:"rel"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	var doc struct {
+		Versions json.RawMessage `json:"versions"`
+		Version  *version        `json:"version"`
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Auth-Token", provider.Token())
+	resp, err := provider.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultipleChoices {
+		return nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("unexpected version document: %w", err)
+	}
+
+	var versions []version
+	if len(doc.Versions) > 0 {
+		if err := json.Unmarshal(doc.Versions, &versions); err != nil {
+			var values struct {
+				Values []version `json:"values"`
+			}
+			if err := json.Unmarshal(doc.Versions, &values); err != nil {
+				return nil, fmt.Errorf("unexpected version document: %w", err)
+			}
+			versions = values.Values
+		}
+	} else if doc.Version != nil {
+		versions = []version{*doc.Version}
+	}
+
+	result := make([]versionLink, 0, len(versions))
+	for _, v := range versions {
+		if v.ID == "" {
+			continue
+		}
+		link := versionLink{ID: v.ID, URL: strings.TrimSuffix(url, "/") + "/" + v.ID}
+		for _, l := range v.Links {
+			if l.Rel != "self" || l.Href == "" {
+				continue
+			}
+			if href, err := req.URL.Parse(l.Href); err == nil {
+				link.URL = strings.TrimSuffix(href.String(), "/")
+			}
+			break
+		}
+		result = append(result, link)
+	}
+	return result, nil
+}
+
+// normalizeVarName turns s into a string usable as a shell variable name,
+// e.g. "object-store" becomes "OBJECT_STORE" and "v2.1" becomes "V2_1".
+func normalizeVarName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+func uniqueStrings(values ...string) []string {
+	result := make([]string, 0, len(values))
+	seen := map[string]bool{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
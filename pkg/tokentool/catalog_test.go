@@ -0,0 +1,173 @@
+package tokentool
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+func testCatalog(url string) *tokens.ServiceCatalog {
+	return &tokens.ServiceCatalog{Entries: []tokens.CatalogEntry{
+		{Type: "compute", Name: "nova", Endpoints: []tokens.Endpoint{
+			{Interface: "public", Region: "eu", URL: url + "/compute/v2.1/project-demo"},
+			{Interface: "internal", Region: "eu", URL: url + "/internal/compute/v2.1"},
+		}},
+		{Type: "identity", Name: "keystone", Endpoints: []tokens.Endpoint{
+			{Interface: "public", Region: "eu", URL: url + "/identity/v3"},
+		}},
+		//a second service of the same type does not replace the first one
+		{Type: "compute", Name: "legacy-nova", Endpoints: []tokens.Endpoint{
+			{Interface: "public", Region: "eu", URL: url + "/legacy"},
+		}},
+		{Type: "object-store", Name: "swift", Endpoints: []tokens.Endpoint{
+			{Interface: "public", Region: "eu", URL: url + "/slow/v1"},
+			{Interface: "public", Region: "us", URL: url + "/us/v1"},
+		}},
+	}}
+}
+
+func TestCatalogVars(t *testing.T) {
+	vars := CatalogVars(testCatalog("https://api"), "eu")
+	expected := map[string]string{
+		"COMPUTE":             "https://api/compute/v2.1/project-demo",
+		"COMPUTE_PUBLIC":      "https://api/compute/v2.1/project-demo",
+		"COMPUTE_INTERNAL":    "https://api/internal/compute/v2.1",
+		"NOVA":                "https://api/compute/v2.1/project-demo",
+		"LEGACY_NOVA":         "https://api/legacy",
+		"OBJECT_STORE":        "https://api/slow/v1",
+		"OBJECT-STORE":        "https://api/slow/v1",
+		"SWIFT_PUBLIC":        "https://api/slow/v1",
+		"IDENTITY":            "https://api/identity/v3",
+		"KEYSTONE":            "https://api/identity/v3",
+		"OBJECT_STORE_PUBLIC": "https://api/slow/v1",
+		"OBJECT-STORE_PUBLIC": "https://api/slow/v1",
+		"IDENTITY_PUBLIC":     "https://api/identity/v3",
+		"KEYSTONE_PUBLIC":     "https://api/identity/v3",
+		"NOVA_PUBLIC":         "https://api/compute/v2.1/project-demo",
+		"NOVA_INTERNAL":       "https://api/internal/compute/v2.1",
+		"LEGACY_NOVA_PUBLIC":  "https://api/legacy",
+		"SWIFT":               "https://api/slow/v1",
+	}
+	for key, value := range expected {
+		if vars[key] != value {
+			t.Errorf("%s = %q, expected %q", key, vars[key], value)
+		}
+	}
+	if len(vars) != len(expected) {
+		t.Errorf("got %d variables, expected %d: %v", len(vars), len(expected), vars)
+	}
+}
+
+func TestDiscoverVersionVars(t *testing.T) {
+	var (
+		mutex     sync.Mutex
+		requested = map[string]int{}
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested[r.URL.Path]++
+		mutex.Unlock()
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/compute/", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested[r.URL.Path]++
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		//nova advertises absolute self links
+		_, _ = w.Write([]byte(`{"versions": [
+			{"id": "v2.0", "links": [{"rel": "self", "href": "http://` + r.Host + `/compute/v2/"}]},
+			{"id": "v2.1", "links": [{"rel": "describedby", "href": "https://docs"}, {"rel": "self", "href": "http://` + r.Host + `/compute/v2.1/"}]}
+		]}`))
+	})
+	mux.HandleFunc("/identity/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultipleChoices)
+		//keystone form with a relative self link
+		_, _ = w.Write([]byte(`{"versions": {"values": [{"id": "v3.14", "links": [{"rel": "self", "href": "/identity/v3/"}]}]}}`))
+	})
+	mux.HandleFunc("/legacy/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		//no self link
+		_, _ = w.Write([]byte(`{"version": {"id": "v2.1"}}`))
+	})
+	release := make(chan struct{})
+	mux.HandleFunc("/slow/", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer close(release)
+
+	provider := &gophercloud.ProviderClient{}
+	provider.SetToken("token")
+	captureLog(t)
+
+	vars := map[string]string{"COMPUTE_V2_0": "preset"}
+	start := time.Now()
+	DiscoverVersionVars(provider, testCatalog(server.URL), VersionDiscoveryOpts{Region: "eu", Timeout: 500 * time.Millisecond}, vars)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("discovery took %s despite the timeout", elapsed)
+	}
+
+	expected := map[string]string{
+		"COMPUTE_V2_0":           "preset",
+		"COMPUTE_PUBLIC_V2_0":    server.URL + "/compute/v2",
+		"COMPUTE_V2_1":           server.URL + "/compute/v2.1",
+		"COMPUTE_PUBLIC_V2_1":    server.URL + "/compute/v2.1",
+		"NOVA_V2_1":              server.URL + "/compute/v2.1",
+		"LEGACY_NOVA_V2_1":       server.URL + "/legacy/v2.1",
+		"IDENTITY_V3_14":         server.URL + "/identity/v3",
+		"KEYSTONE_PUBLIC_V3_14":  server.URL + "/identity/v3",
+		"COMPUTE_INTERNAL_V2_1":  "",
+		"OBJECT_STORE_V1":        "",
+		"OBJECT_STORE_PUBLIC_V1": "",
+	}
+	for key, value := range expected {
+		if vars[key] != value {
+			t.Errorf("%s = %q, expected %q", key, vars[key], value)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if requested["/internal/compute/"] != 0 || requested["/us/"] != 0 {
+		t.Errorf("endpoints of other interfaces or regions were queried: %v", requested)
+	}
+	if requested["/compute/"] != 1 {
+		t.Errorf("the compute version document was requested %d times, expected once", requested["/compute/"])
+	}
+}
+
+func TestDiscoverVersionVarsInterface(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"versions": [{"id": "v2.1"}]}`))
+	}))
+	defer server.Close()
+	captureLog(t)
+
+	vars := map[string]string{}
+	DiscoverVersionVars(&gophercloud.ProviderClient{}, testCatalog(server.URL), VersionDiscoveryOpts{Interface: "internalURL"}, vars)
+	expected := map[string]string{
+		"COMPUTE_INTERNAL_V2_1": server.URL + "/internal/compute/v2.1",
+		"NOVA_INTERNAL_V2_1":    server.URL + "/internal/compute/v2.1",
+	}
+	for key, value := range expected {
+		if vars[key] != value {
+			t.Errorf("%s = %q, expected %q", key, vars[key], value)
+		}
+	}
+	if len(vars) != len(expected) {
+		t.Errorf("got variables %v, expected only those of the internal interface", vars)
+	}
+}
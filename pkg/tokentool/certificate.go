@@ -0,0 +1,334 @@
+package tokentool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// LoadClientCertificate loads the client certificate used for 2FA. certPath may point
+// to a PEM file or to a PKCS#12 bundle (.p12/.pfx). For PEM files the key is read from
+// keyPath or, if that is empty, from certPath itself. Additional certificates found
+// next to the leaf certificate are sent as intermediate chain. Encrypted keys and
+// bundles are decrypted with the passphrase returned by passphrase for their path;
+// if passphrase is nil, they cannot be loaded.
+func LoadClientCertificate(certPath, keyPath string, passphrase func(path string) (string, error)) (tls.Certificate, error) {
+	certData, err := os.ReadFile(certPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+
+	var certs [][]byte
+	var key crypto.PrivateKey
+	if isPEM(certData) {
+		certs, key, err = decodePEMCertificate(certPath, certData, keyPath, passphrase)
+	} else {
+		certs, key, err = decodePKCS12Certificate(certPath, certData, passphrase)
+	}
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if len(certs) == 0 {
+		return tls.Certificate{}, fmt.Errorf("no certificate found in %s", certPath)
+	}
+	if key == nil {
+		return tls.Certificate{}, fmt.Errorf("no private key found for certificate %s", certPath)
+	}
+
+	//move the certificate matching the key to the front, the rest is the chain
+	chain := make([][]byte, 0, len(certs))
+	var leaf *x509.Certificate
+	for _, der := range certs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to parse certificate in %s: %w", certPath, err)
+		}
+		if leaf == nil && publicKeyMatches(cert, key) {
+			leaf = cert
+			chain = append([][]byte{der}, chain...)
+		} else {
+			chain = append(chain, der)
+		}
+	}
+	if leaf == nil {
+		if keyPath == "" {
+			keyPath = certPath
+		}
+		return tls.Certificate{}, fmt.Errorf("the private key in %s does not match the certificate in %s", keyPath, certPath)
+	}
+
+	return tls.Certificate{
+		Certificate: chain,
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// CheckCertificateValidity fails if the client certificate is expired or not yet
+// valid, and warns on stderr if it expires within the given window.
+func CheckCertificateValidity(path string, leaf *x509.Certificate, warnWithin time.Duration) error {
+	now := time.Now()
+	switch {
+	case now.After(leaf.NotAfter):
+		return WithKind(KindTLS, fmt.Errorf("client certificate %s expired at %s", path, leaf.NotAfter.Local().Format(time.RFC1123)))
+	case now.Before(leaf.NotBefore):
+		return WithKind(KindTLS, fmt.Errorf("client certificate %s is not valid before %s", path, leaf.NotBefore.Local().Format(time.RFC1123)))
+	case leaf.NotAfter.Sub(now) < warnWithin:
+		log.Printf("WARNING: client certificate %s expires in %s (%s)", path,
+			leaf.NotAfter.Sub(now).Round(time.Minute), leaf.NotAfter.Local().Format(time.RFC1123))
+	}
+	return nil
+}
+
+func isPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+func publicKeyMatches(cert *x509.Certificate, key crypto.PrivateKey) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(cert.PublicKey)
+}
+
+func decodePEMCertificate(certPath string, certData []byte, keyPath string, passphrase func(string) (string, error)) (certs [][]byte, key crypto.PrivateKey, err error) {
+	keyData := certData
+	if keyPath != "" {
+		keyData, err = os.ReadFile(keyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read client key: %w", err)
+		}
+	} else {
+		keyPath = certPath
+	}
+
+	for rest := certData; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block.Bytes)
+		}
+	}
+
+	for rest := keyData; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs, nil, nil
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		key, err = decodePEMPrivateKey(keyPath, block, passphrase)
+		return certs, key, err
+	}
+}
+
+func decodePEMPrivateKey(keyPath string, block *pem.Block, getPassphrase func(string) (string, error)) (crypto.PrivateKey, error) {
+	der := block.Bytes
+	encrypted := x509.IsEncryptedPEMBlock(block) || block.Type == "ENCRYPTED PRIVATE KEY"
+	if x509.IsEncryptedPEMBlock(block) {
+		passphrase, err := certPassphrase(getPassphrase, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		der, err = x509.DecryptPEMBlock(block, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key %s: %w", keyPath, err)
+		}
+	} else if block.Type == "ENCRYPTED PRIVATE KEY" {
+		passphrase, err := certPassphrase(getPassphrase, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		der, err = decryptPKCS8(der, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key %s: %w", keyPath, err)
+		}
+	}
+
+	key, err := parsePrivateKey(der)
+	if err != nil {
+		//the padding check of CBC decryption passes for about one in 256 wrong
+		//passphrases, the garbage is only detected when parsing it
+		if encrypted {
+			return nil, fmt.Errorf("failed to decrypt private key %s: wrong passphrase", keyPath)
+		}
+		return nil, fmt.Errorf("failed to parse private key %s: %w", keyPath, err)
+	}
+	return key, nil
+}
+
+func decodePKCS12Certificate(path string, data []byte, getPassphrase func(string) (string, error)) (certs [][]byte, key crypto.PrivateKey, err error) {
+	passphrase, err := certPassphrase(getPassphrase, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, leaf, chain, err := pkcs12.DecodeChain(data, passphrase)
+	if err != nil {
+		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			return nil, nil, fmt.Errorf("wrong passphrase for PKCS#12 bundle %s", path)
+		}
+		return nil, nil, fmt.Errorf("failed to decode PKCS#12 bundle %s: %w", path, err)
+	}
+
+	certs = append(certs, leaf.Raw)
+	for _, cert := range chain {
+		certs = append(certs, cert.Raw)
+	}
+	return certs, key, nil
+}
+
+// parsePrivateKey parses a DER encoded PKCS#1, SEC 1 or PKCS#8 private key.
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unknown private key format")
+}
+
+// certPassphrase returns the passphrase for the encrypted key or bundle at path.
+func certPassphrase(getPassphrase func(string) (string, error), path string) (string, error) {
+	if getPassphrase == nil {
+		return "", WithKind(KindConfiguration, fmt.Errorf("%s is encrypted, but no passphrase was given", path))
+	}
+	return getPassphrase(path)
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts an "ENCRYPTED PRIVATE KEY" as written by OpenSSL, i.e. a
+// PKCS#8 EncryptedPrivateKeyInfo using PBES2 with PBKDF2 and AES-CBC or 3DES-CBC.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted PKCS#8 structure: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported PKCS#8 encryption algorithm %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("invalid PBKDF2 parameters: %w", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudo random function %s", kdfParams.PRF.Algorithm)
+	}
+
+	var keyLength int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLength, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLength, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLength, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLength, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#8 encryption scheme %s", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid encryption scheme parameters: %w", err)
+	}
+
+	key := pbkdf2.Key(passphrase, kdfParams.Salt, kdfParams.IterationCount, keyLength, prf)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("malformed encrypted data")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	//strip and verify the PKCS#7 padding, a mismatch is the usual sign of a wrong passphrase
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errors.New("wrong passphrase")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("wrong passphrase")
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
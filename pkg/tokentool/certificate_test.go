@@ -0,0 +1,213 @@
+package tokentool
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the fixtures in testdata/certs are created by testdata/certs/generate.sh
+const testCertPassphrase = "test-passphrase"
+
+// fixedPassphrase returns a passphrase callback for LoadClientCertificate.
+func fixedPassphrase(passphrase string) func(string) (string, error) {
+	return func(string) (string, error) { return passphrase, nil }
+}
+
+func certFixture(name string) string {
+	return filepath.Join("testdata", "certs", name)
+}
+
+func readPEMCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(certFixture(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestLoadClientCertificate(t *testing.T) {
+	ca := readPEMCertificate(t, "ca.pem")
+	intermediate := readPEMCertificate(t, "intermediate.pem")
+
+	//intermediate first, the leaf must still be found by its key
+	reordered := filepath.Join(t.TempDir(), "reordered.pem")
+	var data []byte
+	for _, name := range []string{"intermediate.pem", "client.pem", "client.key.pem"} {
+		part, err := os.ReadFile(certFixture(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, part...)
+	}
+	if err := os.WriteFile(reordered, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		cert, key string
+	}{
+		{certFixture("client-chain-with-key.pem"), ""},
+		{reordered, ""},
+		{certFixture("client-chain.pem"), certFixture("client.key.pem")},
+		{certFixture("client-chain.pem"), certFixture("client-aes256.key.pem")},
+		{certFixture("client-chain.pem"), certFixture("client-3des.key.pem")},
+		{certFixture("client-chain.pem"), certFixture("client-legacy.key.pem")},
+		{certFixture("client-legacy.p12"), ""},
+		{certFixture("client-aes.p12"), ""},
+	}
+	for _, c := range cases {
+		cert, err := LoadClientCertificate(c.cert, c.key, fixedPassphrase(testCertPassphrase))
+		if err != nil {
+			t.Errorf("%s with key %q: %s", c.cert, c.key, err)
+			continue
+		}
+		if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "alice" {
+			t.Errorf("%s: unexpected leaf %v", c.cert, cert.Leaf)
+			continue
+		}
+		if len(cert.Certificate) != 2 || string(cert.Certificate[1]) != string(intermediate.Raw) {
+			t.Errorf("%s: the chain does not consist of the leaf and the intermediate", c.cert)
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+		intermediates := x509.NewCertPool()
+		for _, der := range cert.Certificate[1:] {
+			c, err := x509.ParseCertificate(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			intermediates.AddCert(c)
+		}
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			t.Errorf("%s: the chain does not verify: %s", c.cert, err)
+		}
+	}
+}
+
+func TestLoadClientCertificateErrors(t *testing.T) {
+	cases := []struct {
+		cert, key string
+		message   string
+	}{
+		{certFixture("client-chain.pem"), certFixture("other.key.pem"), "does not match"},
+		{certFixture("client-chain.pem"), "", "no private key found"},
+		{certFixture("client.key.pem"), "", "no certificate found"},
+		{certFixture("missing.pem"), "", "failed to read client certificate"},
+	}
+	for _, c := range cases {
+		_, err := LoadClientCertificate(c.cert, c.key, fixedPassphrase(testCertPassphrase))
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("%s with key %q: got %v, expected an error containing %q", c.cert, c.key, err, c.message)
+		}
+	}
+}
+
+func TestLoadClientCertificateWrongPassphrase(t *testing.T) {
+	for _, key := range []string{"client-aes256.key.pem", "client-3des.key.pem", "client-legacy.key.pem"} {
+		if _, err := LoadClientCertificate(certFixture("client-chain.pem"), certFixture(key), fixedPassphrase("wrong")); err == nil {
+			t.Errorf("%s: expected an error for a wrong passphrase", key)
+		}
+	}
+	for _, bundle := range []string{"client-legacy.p12", "client-aes.p12"} {
+		_, err := LoadClientCertificate(certFixture(bundle), "", fixedPassphrase("wrong"))
+		if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+			t.Errorf("%s: got %v, expected a wrong passphrase error", bundle, err)
+		}
+	}
+}
+
+// TestDecryptPrivateKeyWrongPassphrases tries enough passphrases that some decrypt to
+// data with valid padding, which must be rejected as well.
+func TestDecryptPrivateKeyWrongPassphrases(t *testing.T) {
+	for _, name := range []string{"client-aes256.key.pem", "client-3des.key.pem", "client-legacy.key.pem"} {
+		data, err := os.ReadFile(certFixture(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode(data)
+		tries := 2000
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			//PBKDF2 with 2048 iterations is slow
+			tries = 600
+		}
+		for i := 0; i < tries; i++ {
+			_, err := decodePEMPrivateKey(name, block, fixedPassphrase(fmt.Sprintf("wrong-%d", i)))
+			if err == nil || !strings.Contains(err.Error(), "failed to decrypt private key") {
+				t.Fatalf("%s: got %v for passphrase wrong-%d, expected a decryption error", name, err, i)
+			}
+		}
+	}
+}
+
+func TestDecryptPKCS8Malformed(t *testing.T) {
+	data, err := os.ReadFile(certFixture("client-aes256.key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	for _, der := range [][]byte{nil, {0x30, 0x00}, block.Bytes[:len(block.Bytes)/2], block.Bytes[:len(block.Bytes)-3]} {
+		if _, err := decryptPKCS8(der, []byte(testCertPassphrase)); err == nil {
+			t.Errorf("expected an error for %d bytes of malformed input", len(der))
+		}
+	}
+}
+
+func TestTLSConfigClientCertificate(t *testing.T) {
+	transport := Transport{
+		Cert:           certFixture("client-chain.pem"),
+		Key:            certFixture("client-aes256.key.pem"),
+		CertPassphrase: fixedPassphrase(testCertPassphrase),
+	}
+	config, err := transport.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 1 || config.Certificates[0].Leaf.Subject.CommonName != "alice" {
+		t.Errorf("the client certificate was not configured: %v", config.Certificates)
+	}
+
+	transport.CertPassphrase = nil
+	if _, err := transport.TLSConfig(); ClassifyError(err) != KindConfiguration {
+		t.Errorf("got %v without a passphrase callback, expected a configuration error", err)
+	}
+}
+
+func TestCheckCertificateValidity(t *testing.T) {
+	logs := captureLog(t)
+	now := time.Now()
+
+	expired := &x509.Certificate{NotBefore: now.Add(-48 * time.Hour), NotAfter: now.Add(-time.Hour)}
+	if err := CheckCertificateValidity("client.pem", expired, 0); ClassifyError(err) != KindTLS {
+		t.Errorf("got %v for an expired certificate, expected a TLS error", err)
+	}
+	notYetValid := &x509.Certificate{NotBefore: now.Add(time.Hour), NotAfter: now.Add(48 * time.Hour)}
+	if err := CheckCertificateValidity("client.pem", notYetValid, 0); ClassifyError(err) != KindTLS {
+		t.Errorf("got %v for a certificate not yet valid, expected a TLS error", err)
+	}
+
+	expiring := &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(24 * time.Hour)}
+	if err := CheckCertificateValidity("client.pem", expiring, 7*24*time.Hour); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(logs.String(), "WARNING: client certificate client.pem expires in") {
+		t.Errorf("no warning for a certificate expiring soon:\n%s", logs)
+	}
+}
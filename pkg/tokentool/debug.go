@@ -0,0 +1,350 @@
+package tokentool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redacted = "<redacted>"
+
+// sensitiveHeaders are never printed or recorded in clear text.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":   true,
+	"Cookie":          true,
+	"Set-Cookie":      true,
+	"X-Auth-Token":    true,
+	"X-Service-Token": true,
+	"X-Subject-Token": true,
+}
+
+// sensitiveFields are JSON object keys whose values are redacted in request and
+// response bodies, e.g. passwords, application credential secrets and TOTP codes.
+var sensitiveFields = map[string]bool{
+	"password":          true,
+	"original_password": true,
+	"secret":            true,
+	"passcode":          true,
+	"signature":         true,
+	"access_token_id":   true,
+}
+
+// debugTransport logs every request and response to stderr with secrets redacted
+// if debug is set, and records them into a HAR file if har is set.
+type debugTransport struct {
+	next  http.RoundTripper
+	debug bool
+	har   *harRecorder
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	if t.debug {
+		log.Printf("DEBUG: > %s %s", req.Method, req.URL.Redacted())
+		logHeaders("DEBUG: > ", req.Header)
+		if len(reqBody) > 0 {
+			log.Printf("DEBUG: > %s", redactBody(reqBody))
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+	if err != nil {
+		if t.debug {
+			log.Printf("DEBUG: < %s %s failed after %s: %s", req.Method, req.URL.Redacted(), duration, err)
+		}
+		//failed requests are recorded as well, they are what the trace is needed for
+		if t.har != nil {
+			t.har.Record(req, reqBody, nil, nil, err, start, duration)
+		}
+		return resp, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		if t.har != nil {
+			t.har.Record(req, reqBody, nil, nil, err, start, duration)
+		}
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if t.debug {
+		log.Printf("DEBUG: < %s (%s)", resp.Status, duration.Round(time.Millisecond))
+		logHeaders("DEBUG: < ", resp.Header)
+		if len(respBody) > 0 {
+			log.Printf("DEBUG: < %s", redactBody(respBody))
+		}
+	}
+
+	if t.har != nil {
+		t.har.Record(req, reqBody, resp, respBody, nil, start, duration)
+	}
+	return resp, nil
+}
+
+func logHeaders(prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			log.Printf("%s%s: %s", prefix, name, redactHeader(name, value))
+		}
+	}
+}
+
+func redactHeader(name, value string) string {
+	if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return redacted
+	}
+	return value
+}
+
+// redactBody returns body with all sensitive fields redacted. Bodies that are not
+// JSON are summarized by their size only, because their content cannot be checked.
+func redactBody(body []byte) string {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return fmt.Sprintf("<%d bytes of non-JSON content>", len(body))
+	}
+	var out strings.Builder
+	e := json.NewEncoder(&out)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(redactValue("", data)); err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func redactValue(parent string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			_, isString := child.(string)
+			//{"token": {"id": "..."}} is used for token authentication
+			if isString && (sensitiveFields[key] || (parent == "token" && key == "id")) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(key, child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(parent, child)
+		}
+	}
+	return value
+}
+
+// harRecorder collects the traced requests and rewrites the HAR file after every
+// request, so that the trace is complete even if the process exits or execs curl.
+type harRecorder struct {
+	path    string
+	mutex   sync.Mutex
+	entries []harEntry
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	//Error is set instead of the status for requests that did not get a response.
+	//The name follows the custom field used by browsers.
+	Error string `json:"_error,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+var (
+	harRecordersMutex sync.Mutex
+	harRecorders      = map[string]*harRecorder{}
+)
+
+// getHARRecorder returns the recorder for path, so that all HTTP clients created
+// during one invocation write into the same HAR file. The file is written right
+// away, so that it exists even if no request is made.
+func getHARRecorder(path string) *harRecorder {
+	harRecordersMutex.Lock()
+	defer harRecordersMutex.Unlock()
+	if r, ok := harRecorders[path]; ok {
+		return r
+	}
+	r := &harRecorder{path: path, entries: []harEntry{}}
+	if err := r.write(); err != nil {
+		log.Printf("failed to write HAR file %s: %s", r.path, err)
+	}
+	harRecorders[path] = r
+	return r
+}
+
+// Record adds a request to the HAR file. resp is nil if the request failed with
+// err before a response was received.
+func (r *harRecorder) Record(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error, start time.Time, duration time.Duration) {
+	millis := float64(duration) / float64(time.Millisecond)
+	entry := harEntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Time:            millis,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.Redacted(),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Timings: harTimings{Wait: millis},
+	}
+	if resp != nil {
+		entry.Response = harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+			HTTPVersion: resp.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(resp.Header),
+			Content: harContent{
+				Size:     len(respBody),
+				MimeType: resp.Header.Get("Content-Type"),
+			},
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		}
+	} else {
+		entry.Response = harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+		if err != nil {
+			entry.Response.Error = err.Error()
+		}
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{name, value})
+		}
+	}
+	if len(reqBody) > 0 {
+		entry.Request.PostData = &harPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     redactBody(reqBody),
+		}
+	}
+	if len(respBody) > 0 {
+		entry.Response.Content.Text = redactBody(respBody)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = append(r.entries, entry)
+	if err := r.write(); err != nil {
+		log.Printf("failed to write HAR file %s: %s", r.path, err)
+	}
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	result := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			result = append(result, harNameValue{name, redactHeader(name, value)})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (r *harRecorder) write() error {
+	var har struct {
+		Log struct {
+			Version string `json:"version"`
+			Creator struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"creator"`
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	har.Log.Version = "1.2"
+	har.Log.Creator.Name = "token-tool"
+	har.Log.Creator.Version = Version
+	har.Log.Entries = r.entries
+
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0600)
+}
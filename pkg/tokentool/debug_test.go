@@ -0,0 +1,128 @@
+package tokentool
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testHAR struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method   string `json:"method"`
+				URL      string `json:"url"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status int    `json:"status"`
+				Error  string `json:"_error"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+func readTestHAR(t *testing.T, path string) testHAR {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har testHAR
+	if err := json.Unmarshal(raw, &har); err != nil {
+		t.Fatal(err)
+	}
+	return har
+}
+
+// captureLog redirects the log output to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestHARFileOnAuthenticationFailure(t *testing.T) {
+	logs := captureLog(t)
+	keystone := newTestKeystone(t)
+	harFile := filepath.Join(t.TempDir(), "trace.har")
+
+	a := keystone.authenticator()
+	a.AuthOptions.Password = "wrong"
+	a.Transport.HARFile = harFile
+	if _, err := a.Authenticate(); ClassifyError(err) != KindInvalidCredentials {
+		t.Fatalf("got %v, expected invalid_credentials", err)
+	}
+
+	har := readTestHAR(t, harFile)
+	if len(har.Log.Entries) != 1 || har.Log.Entries[0].Response.Status != 401 {
+		t.Fatalf("expected the failed token request in the HAR file, got %+v", har.Log.Entries)
+	}
+	if postData := har.Log.Entries[0].Request.PostData; postData == nil || strings.Contains(postData.Text, "wrong") {
+		t.Error("the password was not redacted in the HAR file")
+	}
+	if strings.Contains(logs.String(), "DEBUG") {
+		t.Errorf("requests were traced on stderr without --debug:\n%s", logs)
+	}
+}
+
+func TestHARFileOnConnectionFailure(t *testing.T) {
+	captureLog(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String() + "/v3/auth/tokens"
+	listener.Close()
+
+	harFile := filepath.Join(t.TempDir(), "trace.har")
+	client, err := Transport{Timeout: 5 * time.Second, HARFile: harFile}.HTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readTestHAR(t, harFile).Log.Entries) != 0 {
+		t.Fatal("the HAR file was not written empty before the first request")
+	}
+	if _, err := client.Post(url, "application/json", strings.NewReader("{}")); ClassifyError(err) != KindNetwork {
+		t.Fatalf("got %v, expected a network error", err)
+	}
+
+	har := readTestHAR(t, harFile)
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("expected the failed request in the HAR file, got %d entries", len(har.Log.Entries))
+	}
+	entry := har.Log.Entries[0]
+	if entry.Request.Method != "POST" || entry.Request.URL != url || entry.Response.Status != 0 || !strings.Contains(entry.Response.Error, "refused") {
+		t.Errorf("unexpected entry for a failed request: %+v", entry)
+	}
+}
+
+func TestDebugLog(t *testing.T) {
+	logs := captureLog(t)
+	keystone := newTestKeystone(t)
+	a := keystone.authenticator()
+	a.AuthOptions.Password = "secret"
+	a.Transport.Debug = true
+	token, err := a.Authenticate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := logs.String()
+	if !strings.Contains(output, "DEBUG: > POST "+keystone.URL+"/v3/auth/tokens") || !strings.Contains(output, "DEBUG: < 201 Created") {
+		t.Errorf("the request was not traced:\n%s", output)
+	}
+	if strings.Contains(output, `"secret"`) || strings.Contains(output, token.ID) {
+		t.Errorf("secrets were not redacted:\n%s", output)
+	}
+}
@@ -0,0 +1,180 @@
+package tokentool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// ErrorKind classifies errors for scripts. The exit codes are part of the
+// documented interface of the token CLI and must not change.
+type ErrorKind int
+
+const (
+	KindGeneric ErrorKind = iota
+	KindConfiguration
+	KindInvalidCredentials
+	KindAccountLocked
+	KindPasswordExpired
+	KindMFARequired
+	KindScopeNotFound
+	KindTLS
+	KindNetwork
+	KindMissingDependency
+)
+
+var errorKindInfo = map[ErrorKind]struct {
+	name     string
+	exitCode int
+}{
+	KindGeneric:            {"error", 1},
+	KindConfiguration:      {"configuration_error", 2},
+	KindInvalidCredentials: {"invalid_credentials", 3},
+	KindAccountLocked:      {"account_locked", 4},
+	KindPasswordExpired:    {"password_expired", 5},
+	KindMFARequired:        {"mfa_required", 6},
+	KindScopeNotFound:      {"scope_not_found", 7},
+	KindTLS:                {"tls_error", 8},
+	KindNetwork:            {"network_error", 9},
+	KindMissingDependency:  {"missing_dependency", 10},
+}
+
+func (k ErrorKind) String() string {
+	return errorKindInfo[k].name
+}
+
+// ExitCode returns the process exit code for errors of this kind.
+func (k ErrorKind) ExitCode() int {
+	return errorKindInfo[k].exitCode
+}
+
+// Error is an error with a known classification.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// WithKind classifies err as kind unless it is nil or already carries a more
+// specific classification.
+func WithKind(kind ErrorKind, err error) error {
+	var te Error
+	if err == nil || errors.As(err, &te) {
+		return err
+	}
+	return Error{Kind: kind, Err: err}
+}
+
+// ClassifyError determines the kind of err by looking at explicit classifications,
+// keystone responses and the underlying network errors.
+func ClassifyError(err error) ErrorKind {
+	var te Error
+	if errors.As(err, &te) {
+		return te.Kind
+	}
+
+	if resp, ok := UnexpectedResponse(err); ok {
+		message := strings.ToLower(KeystoneErrorMessage(resp.Body))
+		switch {
+		case resp.Actual == 401 && resp.ResponseHeader.Get("Openstack-Auth-Receipt") != "":
+			return KindMFARequired
+		case strings.Contains(message, "password is expired"):
+			return KindPasswordExpired
+		case strings.Contains(message, "account is locked"):
+			return KindAccountLocked
+		case strings.Contains(message, "could not find project"), strings.Contains(message, "could not find domain"),
+			strings.Contains(message, "has no access to"):
+			return KindScopeNotFound
+		case resp.Actual == 401:
+			return KindInvalidCredentials
+		case resp.Actual == 404:
+			return KindScopeNotFound
+		}
+		return KindGeneric
+	}
+
+	var (
+		missingInput    gophercloud.ErrMissingInput
+		invalidInput    gophercloud.ErrInvalidInput
+		missingEnv      gophercloud.ErrMissingEnvironmentVariable
+		missingAnyEnv   gophercloud.ErrMissingAnyoneOfEnvironmentVariables
+		unknownCA       x509.UnknownAuthorityError
+		hostname        x509.HostnameError
+		invalidCert     x509.CertificateInvalidError
+		recordHeader    tls.RecordHeaderError
+		networkError    net.Error
+		dnsError        *net.DNSError
+		operationError  *net.OpError
+		scopeProjectErr gophercloud.ErrScopeProjectIDOrProjectName
+		missingPassword gophercloud.ErrMissingPassword
+	)
+	switch {
+	case errors.As(err, &missingInput), errors.As(err, &invalidInput), errors.As(err, &missingEnv),
+		errors.As(err, &missingAnyEnv), errors.As(err, &scopeProjectErr), errors.As(err, &missingPassword):
+		return KindConfiguration
+	case errors.As(err, &unknownCA), errors.As(err, &hostname), errors.As(err, &invalidCert),
+		errors.As(err, &recordHeader), strings.Contains(err.Error(), "tls: "):
+		return KindTLS
+	case errors.As(err, &networkError), errors.As(err, &dnsError), errors.As(err, &operationError):
+		return KindNetwork
+	}
+	return KindGeneric
+}
+
+// UnexpectedResponse extracts the HTTP response details from gophercloud errors.
+func UnexpectedResponse(err error) (gophercloud.ErrUnexpectedResponseCode, bool) {
+	var (
+		e400 gophercloud.ErrDefault400
+		e401 gophercloud.ErrDefault401
+		e403 gophercloud.ErrDefault403
+		e404 gophercloud.ErrDefault404
+		e429 gophercloud.ErrDefault429
+		e500 gophercloud.ErrDefault500
+		e503 gophercloud.ErrDefault503
+		e    gophercloud.ErrUnexpectedResponseCode
+	)
+	switch {
+	case errors.As(err, &e400):
+		return e400.ErrUnexpectedResponseCode, true
+	case errors.As(err, &e401):
+		return e401.ErrUnexpectedResponseCode, true
+	case errors.As(err, &e403):
+		return e403.ErrUnexpectedResponseCode, true
+	case errors.As(err, &e404):
+		return e404.ErrUnexpectedResponseCode, true
+	case errors.As(err, &e429):
+		return e429.ErrUnexpectedResponseCode, true
+	case errors.As(err, &e500):
+		return e500.ErrUnexpectedResponseCode, true
+	case errors.As(err, &e503):
+		return e503.ErrUnexpectedResponseCode, true
+	case errors.As(err, &e):
+		return e, true
+	}
+	return gophercloud.ErrUnexpectedResponseCode{}, false
+}
+
+// KeystoneErrorMessage returns error.message from a keystone error response body.
+func KeystoneErrorMessage(body []byte) string {
+	var data struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil || data.Error.Message == "" {
+		return string(body)
+	}
+	return data.Error.Message
+}
@@ -0,0 +1,100 @@
+package tokentool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func keystoneError(code int, message string) gophercloud.ErrUnexpectedResponseCode {
+	return gophercloud.ErrUnexpectedResponseCode{
+		Method:         "POST",
+		URL:            "https://keystone.example.com/v3/auth/tokens",
+		Actual:         code,
+		Body:           []byte(fmt.Sprintf(`{"error":{"code":%d,"message":%q}}`, code, message)),
+		ResponseHeader: http.Header{},
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	mfa := keystoneError(401, "Additional authentications steps required.")
+	mfa.ResponseHeader.Set("Openstack-Auth-Receipt", "receipt")
+
+	cases := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{errors.New("something"), KindGeneric},
+		{WithKind(KindMissingDependency, errors.New("curl not found")), KindMissingDependency},
+		{fmt.Errorf("wrapped: %w", WithKind(KindConfiguration, errors.New("bad flag"))), KindConfiguration},
+		{gophercloud.ErrDefault401{ErrUnexpectedResponseCode: keystoneError(401, "The request you have made requires authentication.")}, KindInvalidCredentials},
+		{gophercloud.ErrDefault401{ErrUnexpectedResponseCode: mfa}, KindMFARequired},
+		{gophercloud.ErrDefault401{ErrUnexpectedResponseCode: keystoneError(401, "The password is expired and needs to be changed for user: u.")}, KindPasswordExpired},
+		{gophercloud.ErrDefault401{ErrUnexpectedResponseCode: keystoneError(401, "The account is locked for user: u.")}, KindAccountLocked},
+		{gophercloud.ErrDefault401{ErrUnexpectedResponseCode: keystoneError(401, "User u has no access to project p.")}, KindScopeNotFound},
+		{gophercloud.ErrDefault404{ErrUnexpectedResponseCode: keystoneError(404, "Could not find project: p.")}, KindScopeNotFound},
+		{gophercloud.ErrDefault404{ErrUnexpectedResponseCode: keystoneError(404, "Not found.")}, KindScopeNotFound},
+		{gophercloud.ErrDefault500{ErrUnexpectedResponseCode: keystoneError(500, "Internal error.")}, KindGeneric},
+		{keystoneError(502, "Bad gateway."), KindGeneric},
+		{gophercloud.ErrMissingInput{Argument: "Username"}, KindConfiguration},
+		{gophercloud.ErrMissingPassword{}, KindConfiguration},
+		{fmt.Errorf("auth: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), KindNetwork},
+		{&net.DNSError{Err: "no such host", Name: "keystone.example.com"}, KindNetwork},
+		{errors.New("remote error: tls: handshake failure"), KindTLS},
+	}
+	for _, c := range cases {
+		if kind := ClassifyError(c.err); kind != c.kind {
+			t.Errorf("ClassifyError(%#v) = %s, expected %s", c.err, kind, c.kind)
+		}
+	}
+}
+
+func TestWithKind(t *testing.T) {
+	if WithKind(KindNetwork, nil) != nil {
+		t.Error("WithKind(nil) must be nil")
+	}
+	err := WithKind(KindConfiguration, WithKind(KindScopeNotFound, errors.New("no project")))
+	if ClassifyError(err) != KindScopeNotFound {
+		t.Error("a more specific classification must not be replaced")
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	//the exit codes are documented in the README
+	expected := map[ErrorKind]struct {
+		name     string
+		exitCode int
+	}{
+		KindGeneric:            {"error", 1},
+		KindConfiguration:      {"configuration_error", 2},
+		KindInvalidCredentials: {"invalid_credentials", 3},
+		KindAccountLocked:      {"account_locked", 4},
+		KindPasswordExpired:    {"password_expired", 5},
+		KindMFARequired:        {"mfa_required", 6},
+		KindScopeNotFound:      {"scope_not_found", 7},
+		KindTLS:                {"tls_error", 8},
+		KindNetwork:            {"network_error", 9},
+		KindMissingDependency:  {"missing_dependency", 10},
+	}
+	for kind, e := range expected {
+		if kind.String() != e.name || kind.ExitCode() != e.exitCode {
+			t.Errorf("kind %d is %s with exit code %d, expected %s with %d", kind, kind, kind.ExitCode(), e.name, e.exitCode)
+		}
+	}
+	if len(errorKindInfo) != len(expected) {
+		t.Errorf("%d error kinds are not covered", len(errorKindInfo)-len(expected))
+	}
+}
+
+func TestKeystoneErrorMessage(t *testing.T) {
+	if message := KeystoneErrorMessage([]byte(`{"error":{"message":"Locked."}}`)); message != "Locked." {
+		t.Errorf("got %q", message)
+	}
+	if message := KeystoneErrorMessage([]byte("<html>Bad Gateway</html>")); message != "<html>Bad Gateway</html>" {
+		t.Errorf("got %q for a non-JSON body", message)
+	}
+}
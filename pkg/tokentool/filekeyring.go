@@ -0,0 +1,326 @@
+package tokentool
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileKeyringVersion = 1
+	//scrypt parameters recommended for interactive logins
+	fileKeyringScryptN = 1 << 15
+	fileKeyringScryptR = 8
+	fileKeyringScryptP = 1
+)
+
+// FileKeyring stores secrets in a file encrypted with NaCl secretbox, using a key
+// derived from a master passphrase with scrypt. It is meant for headless systems
+// without a system keyring. After unlocking, the derived key can be cached in the
+// user's runtime directory for UnlockDuration, so that the passphrase is not asked
+// for on every call. The file format is specific to this package and not
+// compatible with age or other encryption tools.
+type FileKeyring struct {
+	//Path defaults to $XDG_DATA_HOME/token-tool/keyring.json.
+	Path string
+	//UnlockDuration is how long the keyring stays unlocked. Zero disables caching.
+	UnlockDuration time.Duration
+	//Passphrase returns the master passphrase, or ErrKeyringLocked if it cannot be
+	//obtained. create is true if a new keyring file is about to be created.
+	Passphrase func(create bool) (string, error)
+}
+
+// fileKeyringData is the on-disk format of the FileKeyring.
+type fileKeyringData struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Nonce   []byte `json:"nonce"`
+	Box     []byte `json:"box"`
+}
+
+// unlockedKey is the derived key cached in the runtime directory.
+type unlockedKey struct {
+	Path      string    `json:"path"`
+	Salt      []byte    `json:"salt"`
+	Key       []byte    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DefaultFileKeyringPath returns $XDG_DATA_HOME/token-tool/keyring.json.
+func DefaultFileKeyringPath() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "token-tool", "keyring.json"), nil
+}
+
+// Get implements Keyring.
+func (k FileKeyring) Get(service, user string) (string, error) {
+	secrets, _, _, err := k.open(false)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[fileKeyringEntry(service, user)]
+	if !ok {
+		return "", ErrKeyringNotFound
+	}
+	return secret, nil
+}
+
+// Set implements Keyring.
+func (k FileKeyring) Set(service, user, secret string) error {
+	secrets, data, key, err := k.open(true)
+	if err != nil {
+		return err
+	}
+	secrets[fileKeyringEntry(service, user)] = secret
+	return k.write(secrets, data, key)
+}
+
+// Delete implements Keyring.
+func (k FileKeyring) Delete(service, user string) error {
+	secrets, data, key, err := k.open(false)
+	if err != nil {
+		return err
+	}
+	entry := fileKeyringEntry(service, user)
+	if _, ok := secrets[entry]; !ok {
+		return ErrKeyringNotFound
+	}
+	delete(secrets, entry)
+	return k.write(secrets, data, key)
+}
+
+// Lock removes the cached key, so that the passphrase is required again.
+func (k FileKeyring) Lock() error {
+	path, err := k.unlockedKeyPath()
+	if err != nil {
+		//without runtime directory the key is never cached
+		return nil
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func fileKeyringEntry(service, user string) string {
+	return service + "/" + user
+}
+
+func (k FileKeyring) path() (string, error) {
+	if k.Path != "" {
+		return k.Path, nil
+	}
+	return DefaultFileKeyringPath()
+}
+
+// open decrypts the keyring file. If it does not exist, ErrKeyringNotFound is
+// returned unless create is set, in which case a new empty keyring is prepared.
+func (k FileKeyring) open(create bool) (map[string]string, *fileKeyringData, []byte, error) {
+	path, err := k.path()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if !create {
+			return nil, nil, nil, ErrKeyringNotFound
+		}
+		return k.create()
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+	var data fileKeyringData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse keyring %s: %w", path, err)
+	}
+	if data.Version != fileKeyringVersion || len(data.Nonce) != 24 {
+		return nil, nil, nil, fmt.Errorf("unsupported keyring format in %s", path)
+	}
+
+	key, cached := k.cachedKey(path, data.Salt)
+	var secrets map[string]string
+	if cached {
+		secrets, err = decryptFileKeyring(&data, key)
+		if err != nil {
+			//e.g. the keyring was replaced, ask for the passphrase instead
+			_ = k.Lock()
+			cached = false
+		}
+	}
+	if !cached {
+		key, err = k.deriveKey(false, &data)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		secrets, err = decryptFileKeyring(&data, key)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		k.cacheKey(path, data.Salt, key)
+	}
+	return secrets, &data, key, nil
+}
+
+func (k FileKeyring) create() (map[string]string, *fileKeyringData, []byte, error) {
+	data := fileKeyringData{
+		Version: fileKeyringVersion,
+		Salt:    make([]byte, 32),
+		N:       fileKeyringScryptN,
+		R:       fileKeyringScryptR,
+		P:       fileKeyringScryptP,
+	}
+	if _, err := io.ReadFull(rand.Reader, data.Salt); err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := k.deriveKey(true, &data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if path, err := k.path(); err == nil {
+		k.cacheKey(path, data.Salt, key)
+	}
+	return map[string]string{}, &data, key, nil
+}
+
+func (k FileKeyring) deriveKey(create bool, data *fileKeyringData) ([]byte, error) {
+	if k.Passphrase == nil {
+		return nil, ErrKeyringLocked
+	}
+	passphrase, err := k.Passphrase(create)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, WithKind(KindConfiguration, errors.New("the keyring passphrase must not be empty"))
+	}
+	return scrypt.Key([]byte(passphrase), data.Salt, data.N, data.R, data.P, 32)
+}
+
+func decryptFileKeyring(data *fileKeyringData, key []byte) (map[string]string, error) {
+	var nonce [24]byte
+	var boxKey [32]byte
+	copy(nonce[:], data.Nonce)
+	copy(boxKey[:], key)
+	plain, ok := secretbox.Open(nil, data.Box, &nonce, &boxKey)
+	if !ok {
+		return nil, WithKind(KindInvalidCredentials, errors.New("failed to unlock keyring: wrong passphrase"))
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted keyring: %w", err)
+	}
+	return secrets, nil
+}
+
+// write encrypts secrets with a fresh nonce and atomically replaces the keyring file.
+func (k FileKeyring) write(secrets map[string]string, data *fileKeyringData, key []byte) error {
+	path, err := k.path()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	var nonce [24]byte
+	var boxKey [32]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return err
+	}
+	copy(boxKey[:], key)
+	data.Nonce = nonce[:]
+	data.Box = secretbox.Seal(nil, plain, &nonce, &boxKey)
+
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(path, raw, 0600); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return nil
+}
+
+// unlockedKeyPath returns the cache file for the derived key. It lives in
+// $XDG_RUNTIME_DIR, which is private to the user and not persisted across reboots.
+func (k FileKeyring) unlockedKeyPath() (string, error) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return "", errors.New("$XDG_RUNTIME_DIR is not set")
+	}
+	return filepath.Join(runtimeDir, "token-tool", "keyring.key"), nil
+}
+
+func (k FileKeyring) cachedKey(path string, salt []byte) ([]byte, bool) {
+	if k.UnlockDuration <= 0 {
+		return nil, false
+	}
+	cachePath, err := k.unlockedKeyPath()
+	if err != nil {
+		return nil, false
+	}
+	raw, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, false
+	}
+	var unlocked unlockedKey
+	if err := json.Unmarshal(raw, &unlocked); err != nil {
+		return nil, false
+	}
+	if time.Now().After(unlocked.ExpiresAt) {
+		//do not leave the key lying around longer than necessary
+		if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("WARNING: failed to remove the expired keyring key %s: %s", cachePath, err)
+		}
+		return nil, false
+	}
+	if unlocked.Path != path || string(unlocked.Salt) != string(salt) {
+		return nil, false
+	}
+	return unlocked.Key, true
+}
+
+// cacheKey keeps the keyring unlocked for UnlockDuration from now. Without a
+// runtime directory the key is not cached at all.
+func (k FileKeyring) cacheKey(path string, salt, key []byte) {
+	if k.UnlockDuration <= 0 {
+		return
+	}
+	cachePath, err := k.unlockedKeyPath()
+	if err != nil {
+		return
+	}
+	raw, err := json.Marshal(unlockedKey{
+		Path:      path,
+		Salt:      salt,
+		Key:       key,
+		ExpiresAt: time.Now().Add(k.UnlockDuration),
+	})
+	if err == nil {
+		err = WriteFileAtomic(cachePath, raw, 0600)
+	}
+	if err != nil {
+		log.Printf("WARNING: failed to keep the keyring unlocked: %s", err)
+	}
+}
@@ -0,0 +1,166 @@
+package tokentool
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFileKeyring returns a FileKeyring in a temporary directory and a counter of
+// the passphrase prompts.
+func newTestFileKeyring(t *testing.T, passphrase string) (*FileKeyring, *int) {
+	t.Helper()
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	prompts := 0
+	return &FileKeyring{
+		Path: filepath.Join(t.TempDir(), "keyring.json"),
+		Passphrase: func(create bool) (string, error) {
+			prompts++
+			return passphrase, nil
+		},
+	}, &prompts
+}
+
+func TestFileKeyringRoundTrip(t *testing.T) {
+	k, _ := newTestFileKeyring(t, "master")
+
+	if _, err := k.Get("openstack", "alice"); !errors.Is(err, ErrKeyringNotFound) {
+		t.Errorf("got %v before the keyring exists, expected ErrKeyringNotFound", err)
+	}
+	if err := k.Set("openstack", "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Set("openstack", "bob", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(k.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret") || strings.Contains(string(raw), "alice") {
+		t.Error("the keyring file contains plain text secrets")
+	}
+	if info, err := os.Stat(k.Path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("keyring file has mode %v (%v), expected 0600", info.Mode().Perm(), err)
+	}
+
+	//a new instance reads the file
+	reopened := FileKeyring{Path: k.Path, Passphrase: k.Passphrase}
+	if secret, err := reopened.Get("openstack", "alice"); err != nil || secret != "secret" {
+		t.Errorf("got %q (%v), expected the stored secret", secret, err)
+	}
+	if err := reopened.Delete("openstack", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("openstack", "alice"); !errors.Is(err, ErrKeyringNotFound) {
+		t.Errorf("got %v after deleting, expected ErrKeyringNotFound", err)
+	}
+	if err := reopened.Delete("openstack", "alice"); !errors.Is(err, ErrKeyringNotFound) {
+		t.Errorf("got %v when deleting twice, expected ErrKeyringNotFound", err)
+	}
+	if secret, err := reopened.Get("openstack", "bob"); err != nil || secret != "other" {
+		t.Errorf("got %q (%v), expected the other secret to be kept", secret, err)
+	}
+}
+
+func TestFileKeyringWrongPassphrase(t *testing.T) {
+	k, _ := newTestFileKeyring(t, "master")
+	if err := k.Set("openstack", "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := FileKeyring{Path: k.Path, Passphrase: func(bool) (string, error) { return "wrong", nil }}
+	if _, err := wrong.Get("openstack", "alice"); ClassifyError(err) != KindInvalidCredentials {
+		t.Errorf("got %v, expected invalid_credentials", err)
+	}
+	if _, err := (FileKeyring{Path: k.Path}).Get("openstack", "alice"); !errors.Is(err, ErrKeyringLocked) {
+		t.Errorf("got %v without passphrase, expected ErrKeyringLocked", err)
+	}
+	empty := FileKeyring{Path: k.Path, Passphrase: func(bool) (string, error) { return "", nil }}
+	if _, err := empty.Get("openstack", "alice"); ClassifyError(err) != KindConfiguration {
+		t.Errorf("got %v for an empty passphrase, expected a configuration error", err)
+	}
+}
+
+func TestFileKeyringUnlockDuration(t *testing.T) {
+	k, prompts := newTestFileKeyring(t, "master")
+	k.UnlockDuration = time.Minute
+	if err := k.Set("openstack", "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Get("openstack", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if *prompts != 1 {
+		t.Errorf("passphrase was asked %d times, expected once while unlocked", *prompts)
+	}
+
+	cachePath := filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "token-tool", "keyring.key")
+	if info, err := os.Stat(cachePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("cached key has mode %v (%v), expected 0600", info.Mode().Perm(), err)
+	}
+
+	if err := k.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Error("Lock did not remove the cached key")
+	}
+	if _, err := k.Get("openstack", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if *prompts != 2 {
+		t.Errorf("passphrase was asked %d times, expected again after locking", *prompts)
+	}
+	if err := k.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Lock(); err != nil {
+		t.Errorf("locking twice: %s", err)
+	}
+}
+
+func TestFileKeyringExpiredKeyIsRemoved(t *testing.T) {
+	k, prompts := newTestFileKeyring(t, "master")
+	k.UnlockDuration = time.Minute
+	if err := k.Set("openstack", "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	//let the cached key expire
+	cachePath := filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "token-tool", "keyring.key")
+	raw, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unlocked unlockedKey
+	if err := json.Unmarshal(raw, &unlocked); err != nil {
+		t.Fatal(err)
+	}
+	unlocked.ExpiresAt = time.Now().Add(-time.Second)
+	if raw, err = json.Marshal(unlocked); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := k.cachedKey(k.Path, unlocked.Salt); ok {
+		t.Fatal("an expired key was used")
+	}
+	if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+		t.Error("the expired key was not removed")
+	}
+
+	if _, err := k.Get("openstack", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if *prompts != 2 {
+		t.Errorf("passphrase was asked %d times, expected again after the expiry", *prompts)
+	}
+}
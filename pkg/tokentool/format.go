@@ -0,0 +1,132 @@
+package tokentool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExecCredentialAPIVersion is the default API version of ExecCredential objects.
+const ExecCredentialAPIVersion = "client.authentication.k8s.io/v1"
+
+// Formatter writes a token in a specific output format.
+type Formatter interface {
+	Format(w io.Writer, token *Token) error
+}
+
+// TextFormatter prints the bare token.
+type TextFormatter struct{}
+
+// Format implements Formatter.
+func (TextFormatter) Format(w io.Writer, token *Token) error {
+	_, err := fmt.Fprintln(w, token.ID)
+	return err
+}
+
+// ExpiresIn returns the remaining lifetime of the token, rounded down to seconds
+// and zero for expired tokens.
+func (t *Token) ExpiresIn() time.Duration {
+	d := time.Until(t.ExpiresAt).Truncate(time.Second)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// JSONFormatter prints the token response body with the token added as token_id and
+// its expiry as expires_at and expires_in (seconds).
+type JSONFormatter struct{}
+
+// Format implements Formatter.
+func (JSONFormatter) Format(w io.Writer, token *Token) error {
+	b, ok := token.Result.Body.(map[string]interface{})
+	if !ok {
+		return errors.New("token response body is not available")
+	}
+	//add the token from the heder to the nested json as token_id
+	b["token_id"] = token.ID
+	b["expires_at"] = token.ExpiresAt.UTC().Format(time.RFC3339)
+	b["expires_in"] = int64(token.ExpiresIn().Seconds())
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(b)
+}
+
+// CurlrcFormatter prints a curl config file setting the token header. The expiry is
+// noted in a leading comment line.
+type CurlrcFormatter struct{}
+
+// Format implements Formatter.
+func (CurlrcFormatter) Format(w io.Writer, token *Token) error {
+	_, err := fmt.Fprintf(w, "# expires_at=%s expires_in=%d\n",
+		token.ExpiresAt.UTC().Format(time.RFC3339), int64(token.ExpiresIn().Seconds()))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "header \"X-Auth-Token: %s\"\nheader \"Content-Type: application/json\"\n", token.ID)
+	return err
+}
+
+// EnvFormatter prints the token and its expiry as environment file with
+// OS_AUTH_TOKEN, OS_AUTH_TOKEN_EXPIRES_AT and OS_AUTH_URL, which can be sourced by
+// shells or used as env file for containers.
+type EnvFormatter struct {
+	AuthURL string
+}
+
+// Format implements Formatter.
+func (f EnvFormatter) Format(w io.Writer, token *Token) error {
+	if f.AuthURL != "" {
+		if _, err := fmt.Fprintf(w, "OS_AUTH_URL=%s\n", f.AuthURL); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "OS_AUTH_TOKEN=%s\nOS_AUTH_TOKEN_EXPIRES_AT=%s\n", token.ID, token.ExpiresAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// ExecCredential is the object exchanged with client-go credential plugins, see
+// https://kubernetes.io/docs/reference/access-authn-authz/authentication/#client-go-credential-plugins
+type ExecCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Spec       *ExecCredentialSpec   `json:"spec,omitempty"`
+	Status     *ExecCredentialStatus `json:"status,omitempty"`
+}
+
+// ExecCredentialSpec is the part of an ExecCredential sent by client-go.
+type ExecCredentialSpec struct {
+	Interactive bool `json:"interactive"`
+}
+
+// ExecCredentialStatus is the part of an ExecCredential returned by the plugin.
+type ExecCredentialStatus struct {
+	Token               string    `json:"token"`
+	ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+}
+
+// ExecCredentialFormatter prints the token as ExecCredential for kubectl.
+type ExecCredentialFormatter struct {
+	//APIVersion defaults to ExecCredentialAPIVersion.
+	APIVersion string
+}
+
+// Format implements Formatter.
+func (f ExecCredentialFormatter) Format(w io.Writer, token *Token) error {
+	apiVersion := f.APIVersion
+	if apiVersion == "" {
+		apiVersion = ExecCredentialAPIVersion
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(ExecCredential{
+		APIVersion: apiVersion,
+		Kind:       "ExecCredential",
+		Status: &ExecCredentialStatus{
+			Token:               token.ID,
+			ExpirationTimestamp: token.ExpiresAt.UTC(),
+		},
+	})
+}
@@ -0,0 +1,191 @@
+package tokentool
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const testTokenResponse = `{"token":{
+	"user":{"id":"user-alice","name":"alice","domain":{"id":"default","name":"Default"}},
+	"project":{"id":"project-demo","name":"demo","domain":{"id":"domain-demo","name":"demo"}}
+}}`
+
+// newFormatTestToken returns a token expiring in one hour with a project-scoped
+// response body.
+func newFormatTestToken(t *testing.T) *Token {
+	t.Helper()
+	token := &Token{ID: "gAAAA-token", ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second)}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(testTokenResponse), &body); err != nil {
+		t.Fatal(err)
+	}
+	token.Result.Body = body
+	return token
+}
+
+func format(t *testing.T, f Formatter, token *Token) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := f.Format(&buf, token); err != nil {
+		t.Fatalf("%T: %s", f, err)
+	}
+	return buf.String()
+}
+
+func TestTextFormatter(t *testing.T) {
+	if output := format(t, TextFormatter{}, newFormatTestToken(t)); output != "gAAAA-token\n" {
+		t.Errorf("got %q", output)
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	token := newFormatTestToken(t)
+	var output struct {
+		TokenID   string `json:"token_id"`
+		ExpiresAt string `json:"expires_at"`
+		ExpiresIn int64  `json:"expires_in"`
+		Token     struct {
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(format(t, JSONFormatter{}, token)), &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.TokenID != token.ID || output.Token.User.ID != "user-alice" {
+		t.Errorf("token ID or response body missing: %+v", output)
+	}
+	if output.ExpiresAt != token.ExpiresAt.UTC().Format(time.RFC3339) {
+		t.Errorf("got expires_at %s", output.ExpiresAt)
+	}
+	if output.ExpiresIn <= 3500 || output.ExpiresIn > 3600 {
+		t.Errorf("got expires_in %d, expected about an hour", output.ExpiresIn)
+	}
+
+	if err := (JSONFormatter{}).Format(&bytes.Buffer{}, &Token{ID: "no-body"}); err == nil {
+		t.Error("expected an error for a token without response body")
+	}
+}
+
+func TestCurlrcFormatter(t *testing.T) {
+	token := newFormatTestToken(t)
+	lines := strings.Split(format(t, CurlrcFormatter{}, token), "\n")
+	if !strings.HasPrefix(lines[0], "# expires_at="+token.ExpiresAt.UTC().Format(time.RFC3339)+" expires_in=") {
+		t.Errorf("got comment line %q", lines[0])
+	}
+	if lines[1] != `header "X-Auth-Token: gAAAA-token"` || lines[2] != `header "Content-Type: application/json"` {
+		t.Errorf("got headers %q", lines[1:])
+	}
+}
+
+func TestEnvFormatter(t *testing.T) {
+	token := newFormatTestToken(t)
+	expiresAt := token.ExpiresAt.UTC().Format(time.RFC3339)
+
+	expected := "OS_AUTH_TOKEN=gAAAA-token\nOS_AUTH_TOKEN_EXPIRES_AT=" + expiresAt + "\n"
+	if output := format(t, EnvFormatter{}, token); output != expected {
+		t.Errorf("got %q, expected %q", output, expected)
+	}
+	expected = "OS_AUTH_URL=https://keystone.example.com/v3\n" + expected
+	if output := format(t, EnvFormatter{AuthURL: "https://keystone.example.com/v3"}, token); output != expected {
+		t.Errorf("got %q, expected %q", output, expected)
+	}
+}
+
+func TestExecCredentialFormatter(t *testing.T) {
+	token := newFormatTestToken(t)
+	for apiVersion, expected := range map[string]string{
+		"":                                     ExecCredentialAPIVersion,
+		"client.authentication.k8s.io/v1beta1": "client.authentication.k8s.io/v1beta1",
+	} {
+		var output ExecCredential
+		if err := json.Unmarshal([]byte(format(t, ExecCredentialFormatter{APIVersion: apiVersion}, token)), &output); err != nil {
+			t.Fatal(err)
+		}
+		if output.APIVersion != expected || output.Kind != "ExecCredential" {
+			t.Errorf("got %s %s, expected %s ExecCredential", output.APIVersion, output.Kind, expected)
+		}
+		if output.Status == nil || output.Status.Token != token.ID || !output.Status.ExpirationTimestamp.Equal(token.ExpiresAt) {
+			t.Errorf("got status %+v", output.Status)
+		}
+	}
+}
+
+func TestK8sSecretFormatter(t *testing.T) {
+	token := newFormatTestToken(t)
+	f := K8sSecretFormatter{
+		Name:        "openstack-token",
+		Namespace:   "ci",
+		Labels:      map[string]string{"app": "deployer"},
+		Keys:        K8sSecretKeys{Token: "OS_AUTH_TOKEN"},
+		IncludeJSON: true,
+	}
+	var secret k8sSecret
+	if err := yaml.Unmarshal([]byte(format(t, f, token)), &secret); err != nil {
+		t.Fatal(err)
+	}
+	if secret.Kind != "Secret" || secret.Metadata.Name != "openstack-token" || secret.Metadata.Namespace != "ci" || secret.Metadata.Labels["app"] != "deployer" {
+		t.Errorf("got metadata %+v", secret)
+	}
+
+	decoded := map[string]string{}
+	for key, value := range secret.Data {
+		v, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			t.Fatalf("value of %s is not base64: %s", key, err)
+		}
+		decoded[key] = string(v)
+	}
+	expected := map[string]string{
+		"OS_AUTH_TOKEN":     token.ID,
+		"expires_at":        token.ExpiresAt.UTC().Format(time.RFC3339),
+		"user_id":           "user-alice",
+		"project_id":        "project-demo",
+		"project_domain_id": "domain-demo",
+	}
+	for key, value := range expected {
+		if decoded[key] != value {
+			t.Errorf("got %s=%q, expected %q", key, decoded[key], value)
+		}
+	}
+	if _, ok := decoded["domain_id"]; ok {
+		t.Error("domain_id must be left out for project-scoped tokens")
+	}
+	if !strings.Contains(decoded["token.json"], `"token_id": "gAAAA-token"`) {
+		t.Errorf("token.json does not contain the JSON format: %s", decoded["token.json"])
+	}
+
+	if err := (K8sSecretFormatter{}).Format(&bytes.Buffer{}, token); ClassifyError(err) != KindConfiguration {
+		t.Errorf("got %v without a name, expected a configuration error", err)
+	}
+}
+
+func TestTokenFile(t *testing.T) {
+	token := newFormatTestToken(t)
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := WriteTokenFile(path, token, "fingerprint"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := token.Result.Body.(map[string]interface{})["auth_fingerprint"]; ok {
+		t.Error("the fingerprint must not be added to the response body of the token")
+	}
+
+	read, fingerprint, err := ReadTokenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ID != token.ID || !read.ExpiresAt.Equal(token.ExpiresAt) || fingerprint != "fingerprint" {
+		t.Errorf("got token %s expiring at %s with fingerprint %q", read.ID, read.ExpiresAt, fingerprint)
+	}
+	if output := format(t, JSONFormatter{}, read); strings.Contains(output, "auth_fingerprint") {
+		t.Errorf("the fingerprint must not be printed: %s", output)
+	}
+}
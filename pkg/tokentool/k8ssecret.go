@@ -0,0 +1,119 @@
+package tokentool
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// K8sSecretKeys are the keys under which K8sSecretFormatter stores the values in the
+// Secret. Empty keys default to those of DefaultK8sSecretKeys.
+type K8sSecretKeys struct {
+	Token           string
+	ExpiresAt       string
+	UserID          string
+	ProjectID       string
+	ProjectDomainID string
+	DomainID        string
+	JSON            string
+}
+
+// DefaultK8sSecretKeys returns the keys used by K8sSecretFormatter unless configured
+// otherwise.
+func DefaultK8sSecretKeys() K8sSecretKeys {
+	return K8sSecretKeys{
+		Token:           "token",
+		ExpiresAt:       "expires_at",
+		UserID:          "user_id",
+		ProjectID:       "project_id",
+		ProjectDomainID: "project_domain_id",
+		DomainID:        "domain_id",
+		JSON:            "token.json",
+	}
+}
+
+// K8sSecretFormatter prints the token, its expiry and the IDs of the user and scope
+// as Kubernetes Secret manifest, ready for `kubectl apply -f -`.
+type K8sSecretFormatter struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	Keys      K8sSecretKeys
+	//IncludeJSON adds the token in the format of JSONFormatter.
+	IncludeJSON bool
+}
+
+// k8sSecret is the subset of the Secret resource written by K8sSecretFormatter.
+type k8sSecret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sObjectMeta     `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type k8sObjectMeta struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+}
+
+// Format implements Formatter.
+func (f K8sSecretFormatter) Format(w io.Writer, token *Token) error {
+	if f.Name == "" {
+		return WithKind(KindConfiguration, errors.New("the name of the Secret is required"))
+	}
+	data := map[string]string{}
+	add := func(key, defaultKey, value string) {
+		if key == "" {
+			key = defaultKey
+		}
+		if value != "" {
+			data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+	defaults := DefaultK8sSecretKeys()
+	add(f.Keys.Token, defaults.Token, token.ID)
+	add(f.Keys.ExpiresAt, defaults.ExpiresAt, token.ExpiresAt.UTC().Format(time.RFC3339))
+	//scope information is not available for tokens without response body
+	if token.Result.Body != nil {
+		if user, err := token.Result.ExtractUser(); err == nil && user != nil {
+			add(f.Keys.UserID, defaults.UserID, user.ID)
+		}
+		if project, err := token.Result.ExtractProject(); err == nil && project != nil {
+			add(f.Keys.ProjectID, defaults.ProjectID, project.ID)
+			add(f.Keys.ProjectDomainID, defaults.ProjectDomainID, project.Domain.ID)
+		}
+		if domain, err := token.Result.ExtractDomain(); err == nil && domain != nil {
+			add(f.Keys.DomainID, defaults.DomainID, domain.ID)
+		}
+	}
+	if f.IncludeJSON {
+		var buf bytes.Buffer
+		if err := (JSONFormatter{}).Format(&buf, token); err != nil {
+			return err
+		}
+		add(f.Keys.JSON, defaults.JSON, buf.String())
+	}
+
+	manifest, err := yaml.Marshal(k8sSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: k8sObjectMeta{
+			Name:      f.Name,
+			Namespace: f.Namespace,
+			Labels:    f.Labels,
+		},
+		Type: "Opaque",
+		Data: data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(manifest)
+	return err
+}
@@ -0,0 +1,105 @@
+package tokentool
+
+import (
+	"errors"
+
+	"github.com/zalando/go-keyring"
+)
+
+// ErrKeyringNotFound is returned by keyrings that have no secret for the requested
+// service and user.
+var ErrKeyringNotFound = errors.New("secret not found in keyring")
+
+// ErrKeyringLocked is returned by keyrings that cannot be unlocked without user
+// interaction.
+var ErrKeyringLocked = errors.New("keyring is locked")
+
+// Keyring stores secrets by service and user.
+type Keyring interface {
+	Get(service, user string) (string, error)
+	Set(service, user, secret string) error
+	Delete(service, user string) error
+}
+
+// DefaultKeyring is used for passwords unless a KeyringSource specifies another
+// keyring.
+var DefaultKeyring Keyring = SystemKeyring{}
+
+// SystemKeyring is the keyring of the operating system: the macOS keychain, the
+// Windows credential manager or the Secret Service on Linux.
+type SystemKeyring struct{}
+
+// Get implements Keyring.
+func (SystemKeyring) Get(service, user string) (string, error) {
+	secret, err := keyring.Get(service, user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrKeyringNotFound
+	}
+	return secret, err
+}
+
+// Set implements Keyring.
+func (SystemKeyring) Set(service, user, secret string) error {
+	return keyring.Set(service, user, secret)
+}
+
+// Delete implements Keyring.
+func (SystemKeyring) Delete(service, user string) error {
+	err := keyring.Delete(service, user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return ErrKeyringNotFound
+	}
+	return err
+}
+
+// NoKeyring disables keyring lookups.
+type NoKeyring struct{}
+
+// Get implements Keyring.
+func (NoKeyring) Get(service, user string) (string, error) {
+	return "", ErrKeyringNotFound
+}
+
+// Set implements Keyring.
+func (NoKeyring) Set(service, user, secret string) error {
+	return WithKind(KindConfiguration, errors.New("the keyring is disabled"))
+}
+
+// Delete implements Keyring.
+func (NoKeyring) Delete(service, user string) error {
+	return ErrKeyringNotFound
+}
+
+// FallbackKeyring uses Primary and switches to Fallback when Primary is not
+// available, e.g. the system keyring on a Linux server without a Secret Service.
+type FallbackKeyring struct {
+	Primary  Keyring
+	Fallback Keyring
+}
+
+// Get implements Keyring.
+func (k FallbackKeyring) Get(service, user string) (string, error) {
+	secret, err := k.Primary.Get(service, user)
+	if err == nil || errors.Is(err, ErrKeyringNotFound) {
+		return secret, err
+	}
+	return k.Fallback.Get(service, user)
+}
+
+// Set implements Keyring.
+func (k FallbackKeyring) Set(service, user, secret string) error {
+	err := k.Primary.Set(service, user, secret)
+	if err == nil {
+		return nil
+	}
+	return k.Fallback.Set(service, user, secret)
+}
+
+// Delete implements Keyring.
+func (k FallbackKeyring) Delete(service, user string) error {
+	err := k.Primary.Delete(service, user)
+	if err == nil || errors.Is(err, ErrKeyringNotFound) {
+		return err
+	}
+	return k.Fallback.Delete(service, user)
+}
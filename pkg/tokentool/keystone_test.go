@@ -0,0 +1,146 @@
+package tokentool
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// testKeystone is a minimal keystone v3 API for password and token authentication
+// and password changes.
+type testKeystone struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	password string
+	expired  bool
+	issued   int
+}
+
+func newTestKeystone(t *testing.T) *testKeystone {
+	t.Helper()
+	k := &testKeystone{password: "secret"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/auth/tokens", k.handleTokens)
+	mux.HandleFunc("/v3/users/", k.handlePassword)
+	k.Server = httptest.NewServer(mux)
+	t.Cleanup(k.Close)
+	return k
+}
+
+// authenticator returns an authenticator for alice in project demo.
+func (k *testKeystone) authenticator() *Authenticator {
+	return &Authenticator{
+		AuthOptions: &gophercloud.AuthOptions{
+			IdentityEndpoint: k.URL + "/v3",
+			Username:         "alice",
+			DomainName:       "Default",
+			Scope:            &gophercloud.AuthScope{ProjectName: "demo", DomainName: "Default"},
+		},
+		Transport: Transport{Timeout: 5 * time.Second},
+	}
+}
+
+func (k *testKeystone) handleTokens(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Auth struct {
+			Identity struct {
+				Methods  []string `json:"methods"`
+				Password struct {
+					User struct {
+						Password string `json:"password"`
+					} `json:"user"`
+				} `json:"password"`
+				Token struct {
+					ID string `json:"id"`
+				} `json:"token"`
+			} `json:"identity"`
+			Scope struct {
+				Project struct {
+					Name string `json:"name"`
+				} `json:"project"`
+			} `json:"scope"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeKeystoneError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	identity := req.Auth.Identity
+	switch {
+	case len(identity.Methods) == 1 && identity.Methods[0] == "token":
+		if !strings.HasPrefix(identity.Token.ID, "token-") {
+			writeKeystoneError(w, http.StatusNotFound, "Could not find token.")
+			return
+		}
+	case identity.Password.User.Password != k.password:
+		writeKeystoneError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+		return
+	case k.expired:
+		writeKeystoneError(w, http.StatusUnauthorized, "The password is expired and needs to be changed for user: user-alice.")
+		return
+	}
+	project := req.Auth.Scope.Project.Name
+	if project == "forbidden" {
+		writeKeystoneError(w, http.StatusUnauthorized, "User user-alice has no access to project forbidden.")
+		return
+	}
+
+	k.issued++
+	token := map[string]interface{}{
+		"methods":    identity.Methods,
+		"expires_at": time.Now().Add(time.Hour).UTC().Format("2006-01-02T15:04:05.000000Z"),
+		"user":       map[string]interface{}{"id": "user-alice", "name": "alice", "domain": map[string]string{"id": "default", "name": "Default"}},
+		"catalog":    []interface{}{},
+	}
+	if project != "" {
+		token["project"] = map[string]interface{}{"id": "project-" + project, "name": project, "domain": map[string]string{"id": "default", "name": "Default"}}
+	}
+	w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%s-%d", project, k.issued))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"token": token})
+}
+
+func (k *testKeystone) handlePassword(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v3/users/user-alice/password" {
+		writeKeystoneError(w, http.StatusNotFound, "Could not find user.")
+		return
+	}
+	var req struct {
+		User struct {
+			OriginalPassword string `json:"original_password"`
+			Password         string `json:"password"`
+		} `json:"user"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeKeystoneError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if req.User.OriginalPassword != k.password {
+		writeKeystoneError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+		return
+	}
+	k.password = req.User.Password
+	k.expired = false
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeKeystoneError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	})
+}
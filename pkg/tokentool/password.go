@@ -0,0 +1,334 @@
+package tokentool
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/howeyc/gopass"
+	"golang.org/x/term"
+)
+
+// ErrNoPassword is returned by password sources that cannot provide a password, so
+// that the next source is asked.
+var ErrNoPassword = errors.New("no password available")
+
+// PasswordSource provides the password of the user described by authOptions.
+type PasswordSource interface {
+	Password(authOptions *gophercloud.AuthOptions) (string, error)
+}
+
+// PasswordSourceFunc adapts an ordinary function to a PasswordSource.
+type PasswordSourceFunc func(authOptions *gophercloud.AuthOptions) (string, error)
+
+// Password implements PasswordSource.
+func (f PasswordSourceFunc) Password(authOptions *gophercloud.AuthOptions) (string, error) {
+	return f(authOptions)
+}
+
+// ResolvePassword fills in the password, or for application credentials the
+// secret, from the first source providing one. Nothing is done if it is already
+// known or no user is given.
+func ResolvePassword(authOptions *gophercloud.AuthOptions, sources ...PasswordSource) error {
+	target := &authOptions.Password
+	if UsesApplicationCredential(authOptions) {
+		target = &authOptions.ApplicationCredentialSecret
+	} else if authOptions.Username == "" && authOptions.UserID == "" {
+		return nil
+	}
+	if *target != "" {
+		return nil
+	}
+
+	for _, source := range sources {
+		password, err := source.Password(authOptions)
+		if errors.Is(err, ErrNoPassword) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		*target = password
+		return nil
+	}
+	return nil
+}
+
+// UsesApplicationCredential reports whether authOptions authenticate with an
+// application credential instead of a password.
+func UsesApplicationCredential(authOptions *gophercloud.AuthOptions) bool {
+	return authOptions.ApplicationCredentialID != "" || authOptions.ApplicationCredentialName != ""
+}
+
+// DefaultSourceTimeout limits how long the command and pipe sources wait for a
+// password.
+const DefaultSourceTimeout = 30 * time.Second
+
+// EnvSource takes the password from an environment variable.
+type EnvSource struct {
+	//Variable defaults to OS_PASSWORD, or OS_APPLICATION_CREDENTIAL_SECRET for
+	//application credentials.
+	Variable string
+}
+
+// Password implements PasswordSource.
+func (s EnvSource) Password(authOptions *gophercloud.AuthOptions) (string, error) {
+	variable := s.Variable
+	if variable == "" {
+		variable = "OS_PASSWORD"
+		if UsesApplicationCredential(authOptions) {
+			variable = "OS_APPLICATION_CREDENTIAL_SECRET"
+		}
+	}
+	pw := os.Getenv(variable)
+	if pw == "" {
+		return "", ErrNoPassword
+	}
+	return pw, nil
+}
+
+// FileSource reads the password from the first line of a file.
+type FileSource struct {
+	Path string
+}
+
+// Password implements PasswordSource.
+func (s FileSource) Password(authOptions *gophercloud.AuthOptions) (string, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Mode().Perm()&0077 != 0 {
+		log.Printf("WARNING: password file %s is accessible by other users", s.Path)
+	}
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("password file %s is empty", s.Path)
+	}
+	return line, nil
+}
+
+// CommandSource runs a shell command, e.g. "pass show openstack", and uses its
+// trimmed stdout as password or application credential secret. The output is never
+// logged. The command gets no stdin, so that it cannot consume input meant for
+// others, but it can still prompt on the terminal via /dev/tty. On timeout, the
+// command is killed together with all processes it started.
+type CommandSource struct {
+	Command string
+	//Timeout defaults to DefaultSourceTimeout.
+	Timeout time.Duration
+}
+
+// Password implements PasswordSource.
+func (s CommandSource) Password(authOptions *gophercloud.AuthOptions) (string, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSourceTimeout
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", s.Command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	restore := startInProcessGroup(cmd)
+	defer restore()
+	if err := cmd.Start(); err != nil {
+		return "", WithKind(KindConfiguration, fmt.Errorf("failed to run password command: %w", err))
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", WithKind(KindConfiguration, fmt.Errorf("password command failed: %w", err))
+		}
+	case <-time.After(timeout):
+		//do not wait for Wait, children that left the process group may keep stdout open
+		killProcessGroup(cmd)
+		return "", WithKind(KindConfiguration, fmt.Errorf("password command did not finish within %s", timeout))
+	}
+
+	pw := strings.TrimSpace(stdout.String())
+	if pw == "" {
+		return "", WithKind(KindConfiguration, errors.New("password command returned no output"))
+	}
+	return pw, nil
+}
+
+// PipeSource reads the password from the first line written to a named pipe
+// (FIFO), e.g. by a secret manager agent.
+type PipeSource struct {
+	Path string
+	//Timeout defaults to DefaultSourceTimeout.
+	Timeout time.Duration
+}
+
+// Password implements PasswordSource.
+func (s PipeSource) Password(authOptions *gophercloud.AuthOptions) (string, error) {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open password pipe: %w", err)
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return "", WithKind(KindConfiguration, fmt.Errorf("%s is not a named pipe", s.Path))
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSourceTimeout
+	}
+
+	type result struct {
+		line string
+		err  error
+	}
+	//opening a pipe blocks until a writer shows up
+	done := make(chan result, 1)
+	go func() {
+		f, err := os.Open(s.Path)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer f.Close()
+		line, err := bufio.NewReader(f).ReadString('\n')
+		if err == io.EOF {
+			err = nil
+		}
+		done <- result{line: line, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return "", fmt.Errorf("failed to read password pipe: %w", r.err)
+		}
+		line := strings.TrimRight(r.line, "\r\n")
+		if line == "" {
+			return "", fmt.Errorf("no password written to pipe %s", s.Path)
+		}
+		return line, nil
+	case <-time.After(timeout):
+		return "", WithKind(KindConfiguration, fmt.Errorf("no password written to pipe %s within %s", s.Path, timeout))
+	}
+}
+
+// KeyringSource looks up the password in a keyring.
+type KeyringSource struct {
+	//Keyring defaults to DefaultKeyring.
+	Keyring Keyring
+	//Service is the keyring service name, "openstack" if empty. The username is
+	//used as key.
+	Service string
+}
+
+// Password implements PasswordSource.
+func (s KeyringSource) Password(authOptions *gophercloud.AuthOptions) (string, error) {
+	kr := s.Keyring
+	if kr == nil {
+		kr = DefaultKeyring
+	}
+	service := s.Service
+	if service == "" {
+		service = "openstack"
+	}
+	//the keyring holds user passwords only
+	if authOptions.Username == "" || UsesApplicationCredential(authOptions) {
+		return "", ErrNoPassword
+	}
+	pw, err := kr.Get(service, authOptions.Username)
+	if errors.Is(err, ErrKeyringNotFound) {
+		return "", ErrNoPassword
+	}
+	if errors.Is(err, ErrKeyringLocked) {
+		log.Println("Keyring is locked, skipping it")
+		return "", ErrNoPassword
+	}
+	if err != nil {
+		var te Error
+		if errors.As(err, &te) {
+			//e.g. a wrong passphrase for the file keyring
+			return "", err
+		}
+		return "", ErrNoPassword
+	}
+	log.Println("Using password from keyring")
+	return pw, nil
+}
+
+// PromptSource prompts for the password on the terminal. It provides nothing if
+// stdin is not a terminal.
+type PromptSource struct{}
+
+// Password implements PasswordSource.
+func (PromptSource) Password(authOptions *gophercloud.AuthOptions) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", ErrNoPassword
+	}
+	prompt := "Password: "
+	if UsesApplicationCredential(authOptions) {
+		prompt = "Application credential secret: "
+	}
+	password, err := gopass.GetPasswdPrompt(prompt, true, os.Stdin, os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(password), nil
+}
+
+// StdinSource reads the password from the first line of stdin. The line is read
+// byte by byte, so that the rest of stdin stays available, e.g. as request body for
+// curl. It provides nothing if stdin is a terminal.
+type StdinSource struct{}
+
+// Password implements PasswordSource.
+func (StdinSource) Password(authOptions *gophercloud.AuthOptions) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", ErrNoPassword
+	}
+	line, err := readLineUnbuffered(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password from stdin: %w", err)
+	}
+	if line == "" {
+		return "", WithKind(KindConfiguration, errors.New("no password given on stdin"))
+	}
+	log.Println("Password read from stdin")
+	return line, nil
+}
+
+// readLineUnbuffered reads up to and including the next newline without consuming
+// any further input.
+func readLineUnbuffered(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
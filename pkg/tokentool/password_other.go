@@ -0,0 +1,16 @@
+//go:build !unix
+
+package tokentool
+
+import "os/exec"
+
+// startInProcessGroup is a no-op on platforms without process groups.
+func startInProcessGroup(cmd *exec.Cmd) (restore func()) {
+	return func() {}
+}
+
+// killProcessGroup kills the command. Processes started by it keep running on
+// platforms without process groups.
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,195 @@
+package tokentool
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// testKeyring is an in-memory Keyring. err, if set, is returned by all methods.
+type testKeyring struct {
+	secrets map[string]string
+	err     error
+}
+
+func (k *testKeyring) Get(service, user string) (string, error) {
+	if k.err != nil {
+		return "", k.err
+	}
+	secret, ok := k.secrets[service+"/"+user]
+	if !ok {
+		return "", ErrKeyringNotFound
+	}
+	return secret, nil
+}
+
+func (k *testKeyring) Set(service, user, secret string) error {
+	if k.err != nil {
+		return k.err
+	}
+	if k.secrets == nil {
+		k.secrets = map[string]string{}
+	}
+	k.secrets[service+"/"+user] = secret
+	return nil
+}
+
+func (k *testKeyring) Delete(service, user string) error {
+	if k.err != nil {
+		return k.err
+	}
+	if _, ok := k.secrets[service+"/"+user]; !ok {
+		return ErrKeyringNotFound
+	}
+	delete(k.secrets, service+"/"+user)
+	return nil
+}
+
+var (
+	userAuthOptions    = &gophercloud.AuthOptions{Username: "alice"}
+	appCredAuthOptions = &gophercloud.AuthOptions{ApplicationCredentialID: "app-cred"}
+)
+
+// replaceStdin makes os.Stdin read content for the rest of the test.
+func replaceStdin(t *testing.T, content string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = io.WriteString(w, content)
+		w.Close()
+	}()
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+func expectPassword(t *testing.T, source PasswordSource, authOptions *gophercloud.AuthOptions, expected string) {
+	t.Helper()
+	pw, err := source.Password(authOptions)
+	if err != nil {
+		t.Fatalf("%T: unexpected error: %s", source, err)
+	}
+	if pw != expected {
+		t.Errorf("%T: got password %q, expected %q", source, pw, expected)
+	}
+}
+
+func expectNoPassword(t *testing.T, source PasswordSource, authOptions *gophercloud.AuthOptions) {
+	t.Helper()
+	if _, err := source.Password(authOptions); !errors.Is(err, ErrNoPassword) {
+		t.Errorf("%T: got %v, expected ErrNoPassword", source, err)
+	}
+}
+
+func expectSourceError(t *testing.T, source PasswordSource, authOptions *gophercloud.AuthOptions) {
+	t.Helper()
+	if _, err := source.Password(authOptions); err == nil || errors.Is(err, ErrNoPassword) {
+		t.Errorf("%T: got %v, expected an error", source, err)
+	}
+}
+
+func TestResolvePassword(t *testing.T) {
+	skipped := PasswordSourceFunc(func(*gophercloud.AuthOptions) (string, error) { return "", ErrNoPassword })
+	fixed := func(pw string) PasswordSource {
+		return PasswordSourceFunc(func(*gophercloud.AuthOptions) (string, error) { return pw, nil })
+	}
+
+	authOptions := &gophercloud.AuthOptions{Username: "alice"}
+	if err := ResolvePassword(authOptions, skipped, fixed("first"), fixed("second")); err != nil {
+		t.Fatal(err)
+	}
+	if authOptions.Password != "first" {
+		t.Errorf("got password %q, expected the one of the first source providing one", authOptions.Password)
+	}
+	if err := ResolvePassword(authOptions, fixed("other")); err != nil || authOptions.Password != "first" {
+		t.Error("a known password must not be replaced")
+	}
+
+	appCred := &gophercloud.AuthOptions{ApplicationCredentialName: "ci", Username: "alice"}
+	if err := ResolvePassword(appCred, fixed("app-secret")); err != nil {
+		t.Fatal(err)
+	}
+	if appCred.ApplicationCredentialSecret != "app-secret" || appCred.Password != "" {
+		t.Error("application credentials must receive the secret instead of the password")
+	}
+
+	noUser := &gophercloud.AuthOptions{}
+	if err := ResolvePassword(noUser, fixed("unused")); err != nil || noUser.Password != "" {
+		t.Error("no password must be resolved without a user")
+	}
+
+	failing := PasswordSourceFunc(func(*gophercloud.AuthOptions) (string, error) { return "", errors.New("broken") })
+	if err := ResolvePassword(&gophercloud.AuthOptions{UserID: "u"}, failing, fixed("unused")); err == nil {
+		t.Error("errors of a source must abort the resolution")
+	}
+}
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv("OS_PASSWORD", "from-env")
+	t.Setenv("OS_APPLICATION_CREDENTIAL_SECRET", "app-secret")
+	t.Setenv("CUSTOM_PASSWORD", "")
+
+	expectPassword(t, EnvSource{}, userAuthOptions, "from-env")
+	expectPassword(t, EnvSource{}, appCredAuthOptions, "app-secret")
+	expectNoPassword(t, EnvSource{Variable: "CUSTOM_PASSWORD"}, userAuthOptions)
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "password")
+	if err := os.WriteFile(path, []byte("from-file\r\nsecond line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectPassword(t, FileSource{Path: path}, userAuthOptions, "from-file")
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectSourceError(t, FileSource{Path: empty}, userAuthOptions)
+	expectSourceError(t, FileSource{Path: filepath.Join(dir, "missing")}, userAuthOptions)
+}
+
+func TestKeyringSource(t *testing.T) {
+	kr := &testKeyring{secrets: map[string]string{"openstack/alice": "from-keyring", "custom/alice": "custom"}}
+	expectPassword(t, KeyringSource{Keyring: kr}, userAuthOptions, "from-keyring")
+	expectPassword(t, KeyringSource{Keyring: kr, Service: "custom"}, userAuthOptions, "custom")
+	expectNoPassword(t, KeyringSource{Keyring: kr}, &gophercloud.AuthOptions{Username: "bob"})
+	expectNoPassword(t, KeyringSource{Keyring: kr}, appCredAuthOptions)
+
+	expectNoPassword(t, KeyringSource{Keyring: &testKeyring{err: ErrKeyringLocked}}, userAuthOptions)
+	expectNoPassword(t, KeyringSource{Keyring: &testKeyring{err: errors.New("no dbus")}}, userAuthOptions)
+	expectSourceError(t, KeyringSource{Keyring: &testKeyring{err: WithKind(KindInvalidCredentials, errors.New("wrong passphrase"))}}, userAuthOptions)
+}
+
+func TestPromptSourceWithoutTerminal(t *testing.T) {
+	replaceStdin(t, "not a terminal\n")
+	expectNoPassword(t, PromptSource{}, userAuthOptions)
+}
+
+func TestStdinSource(t *testing.T) {
+	replaceStdin(t, "from-stdin\r\nrequest body")
+	expectPassword(t, StdinSource{}, userAuthOptions, "from-stdin")
+	rest, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "request body" {
+		t.Errorf("stdin continues with %q, expected the rest after the password", rest)
+	}
+
+	replaceStdin(t, "")
+	if _, err := (StdinSource{}).Password(userAuthOptions); ClassifyError(err) != KindConfiguration {
+		t.Errorf("got %v for empty stdin, expected a configuration error", err)
+	}
+}
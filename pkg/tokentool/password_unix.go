@@ -0,0 +1,53 @@
+//go:build unix
+
+package tokentool
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startInProcessGroup makes cmd run in its own process group, so that its children
+// are killed with it on timeout. Reading from the terminal stops background process
+// groups, so the command becomes the foreground process group while it runs, if we
+// are. The returned function gives the terminal back and must be called once the
+// command finished.
+func startInProcessGroup(cmd *exec.Cmd) (restore func()) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return func() {}
+	}
+	pgrp, err := unix.IoctlGetInt(int(tty.Fd()), unix.TIOCGPGRP)
+	if err != nil || pgrp != syscall.Getpgrp() {
+		tty.Close()
+		return func() {}
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = int(tty.Fd())
+	return func() {
+		restoreForeground(tty, pgrp)
+		tty.Close()
+	}
+}
+
+// restoreForeground makes pgrp the foreground process group of tty again after a
+// password command ran in the foreground. SIGTTOU, which is sent to background
+// process groups changing the terminal settings, is ignored while doing so.
+func restoreForeground(tty *os.File, pgrp int) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	if err := unix.IoctlSetPointerInt(int(tty.Fd()), unix.TIOCSPGRP, pgrp); err != nil {
+		log.Printf("WARNING: failed to take back the terminal from the password command: %s", err)
+	}
+}
+
+// killProcessGroup kills the process group started by startInProcessGroup.
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
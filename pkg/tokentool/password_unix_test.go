@@ -0,0 +1,85 @@
+//go:build unix
+
+package tokentool
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCommandSource(t *testing.T) {
+	expectPassword(t, CommandSource{Command: "echo '  from-command  '"}, userAuthOptions, "from-command")
+	expectSourceError(t, CommandSource{Command: "exit 1"}, userAuthOptions)
+	expectSourceError(t, CommandSource{Command: "true"}, userAuthOptions)
+
+	start := time.Now()
+	_, err := CommandSource{Command: "sleep 10; echo late", Timeout: 200 * time.Millisecond}.Password(userAuthOptions)
+	if ClassifyError(err) != KindConfiguration {
+		t.Errorf("got %v, expected a timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the timeout took %s", elapsed)
+	}
+}
+
+func TestCommandSourceTimeoutKillsChildren(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	command := "sleep 30 & echo $! > " + pidFile + "; wait"
+	_, err := CommandSource{Command: command, Timeout: 500 * time.Millisecond}.Password(userAuthOptions)
+	if ClassifyError(err) != KindConfiguration {
+		t.Fatalf("got %v, expected a timeout error", err)
+	}
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the orphaned child is reaped by init once it is killed
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if syscall.Kill(pid, 0) != nil || (err == nil && strings.Contains(string(stat), ") Z ")) {
+			return
+		}
+	}
+	_ = syscall.Kill(pid, syscall.SIGKILL)
+	t.Errorf("child process %d of the password command survived the timeout", pid)
+}
+
+func TestPipeSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		_, _ = io.WriteString(f, "from-pipe\n")
+	}()
+	expectPassword(t, PipeSource{Path: path, Timeout: 5 * time.Second}, userAuthOptions, "from-pipe")
+
+	//nobody writes to the pipe
+	_, err := PipeSource{Path: path, Timeout: 100 * time.Millisecond}.Password(userAuthOptions)
+	if ClassifyError(err) != KindConfiguration {
+		t.Errorf("got %v, expected a timeout error", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "regular")
+	if err := os.WriteFile(file, []byte("pw\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectSourceError(t, PipeSource{Path: file}, userAuthOptions)
+}
@@ -0,0 +1,135 @@
+package tokentool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// retryTransport retries requests that failed with a network error (idempotent
+// methods only) or were answered with 429 or a 5xx status. The delay between
+// attempts grows exponentially and follows the Retry-After header when present.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+
+	//math/rand is not seeded before Go 1.20, so without an own source every process
+	//would use the same jitter and concurrent clients would retry in lockstep
+	randMutex sync.Mutex
+	rand      *rand.Rand
+}
+
+func newRetryTransport(next http.RoundTripper, maxRetries int) *retryTransport {
+	return &retryTransport{
+		next:       next,
+		maxRetries: maxRetries,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.maxRetries || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp); ok {
+				delay = d
+			}
+			log.Printf("%s %s returned %s, retrying in %s", req.Method, req.URL.Redacted(), resp.Status, delay)
+			//drain the body to allow reusing the connection
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		} else {
+			log.Printf("%s %s failed: %s, retrying in %s", req.Method, req.URL.Redacted(), err, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body for retry: %w", err)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return isIdempotent(req) && !errors.Is(err, req.Context().Err())
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		//the request was not processed by the service, so retrying is safe for all methods
+		return true
+	default:
+		return resp.StatusCode >= 500 && isIdempotent(req)
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns the exponential delay with jitter for the given attempt.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	t.randMutex.Lock()
+	defer t.randMutex.Unlock()
+	return delay/2 + time.Duration(t.rand.Int63n(int64(delay/2)))
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or as HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		delay = time.Until(t)
+	} else {
+		return 0, false
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay, true
+}
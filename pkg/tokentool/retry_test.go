@@ -0,0 +1,83 @@
+package tokentool
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	transport := newRetryTransport(http.DefaultTransport, 3)
+	for attempt, max := range []time.Duration{retryBaseDelay, 2 * retryBaseDelay, 4 * retryBaseDelay} {
+		for i := 0; i < 100; i++ {
+			if delay := transport.backoff(attempt); delay < max/2 || delay >= max {
+				t.Fatalf("attempt %d: delay %s is not between %s and %s", attempt, delay, max/2, max)
+			}
+		}
+	}
+	if delay := transport.backoff(100); delay < retryMaxDelay/2 || delay >= retryMaxDelay {
+		t.Errorf("delay %s exceeds the maximum", delay)
+	}
+}
+
+func TestBackoffJitterDiffersBetweenTransports(t *testing.T) {
+	sequence := func() string {
+		transport := newRetryTransport(http.DefaultTransport, 3)
+		var delays []string
+		for i := 0; i < 5; i++ {
+			delays = append(delays, transport.backoff(5).String())
+		}
+		return strings.Join(delays, ",")
+	}
+	first := sequence()
+	time.Sleep(time.Millisecond)
+	if second := sequence(); first == second {
+		t.Errorf("two transports produced the same jitter %s", first)
+	}
+}
+
+func TestBackoffConcurrent(t *testing.T) {
+	//run with -race
+	transport := newRetryTransport(http.DefaultTransport, 3)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				transport.backoff(1)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRetryTransport(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := Transport{Retries: 2, Timeout: 5 * time.Second}.HTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Post(server.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || attempts != 3 {
+		t.Errorf("got status %d after %d attempts, expected 204 after 3", resp.StatusCode, attempts)
+	}
+}
@@ -0,0 +1,42 @@
+#!/bin/sh
+# Generates the client certificate fixtures used by certificate_test.go with
+# OpenSSL 3. The certificates are valid for 100 years. Run from this directory.
+set -eu
+
+PASS=pass:test-passphrase
+rm -f *.pem *.p12
+
+# CA -> intermediate -> client
+openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days 36500 \
+	-subj "/CN=Test Root CA" -keyout ca.key.pem -out ca.pem 2>/dev/null
+openssl req -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes \
+	-subj "/CN=Test Intermediate CA" -keyout intermediate.key.pem -out intermediate.csr 2>/dev/null
+printf 'basicConstraints=critical,CA:TRUE\nkeyUsage=critical,keyCertSign\n' > ca.ext
+openssl x509 -req -in intermediate.csr -CA ca.pem -CAkey ca.key.pem -CAcreateserial \
+	-days 36500 -extfile ca.ext -out intermediate.pem 2>/dev/null
+openssl req -newkey rsa:2048 -nodes -subj "/CN=alice" -keyout client.key.pem -out client.csr 2>/dev/null
+printf 'extendedKeyUsage=clientAuth\n' > client.ext
+openssl x509 -req -in client.csr -CA intermediate.pem -CAkey intermediate.key.pem -CAcreateserial \
+	-days 36500 -extfile client.ext -out client.pem 2>/dev/null
+
+# client certificate followed by the intermediate, with and without the key
+cat client.pem intermediate.pem > client-chain.pem
+cat client-chain.pem client.key.pem > client-chain-with-key.pem
+
+# encrypted keys: PKCS#8 with PBES2 (AES-256/HMAC-SHA256 and 3DES/HMAC-SHA1) and
+# the legacy encrypted PEM format (Proc-Type/DEK-Info headers)
+openssl pkcs8 -topk8 -in client.key.pem -v2 aes-256-cbc -v2prf hmacWithSHA256 -passout $PASS -out client-aes256.key.pem
+openssl pkcs8 -topk8 -in client.key.pem -v2 des3 -v2prf hmacWithSHA1 -passout $PASS -out client-3des.key.pem
+openssl rsa -in client.key.pem -traditional -aes256 -passout $PASS -out client-legacy.key.pem 2>/dev/null
+
+# PKCS#12 bundles with the intermediate, with the legacy algorithms and with the
+# OpenSSL 3 defaults (AES, PBMAC with SHA-256)
+openssl pkcs12 -export -legacy -inkey client.key.pem -in client.pem -certfile intermediate.pem \
+	-passout $PASS -out client-legacy.p12
+openssl pkcs12 -export -inkey client.key.pem -in client.pem -certfile intermediate.pem \
+	-passout $PASS -out client-aes.p12
+
+# a key not matching the client certificate
+openssl genpkey -algorithm ec -pkeyopt ec_paramgen_curve:P-256 -out other.key.pem
+
+rm -f *.csr *.ext *.srl ca.key.pem intermediate.key.pem
@@ -0,0 +1,91 @@
+package tokentool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReadTokenFile reads a token written by WriteTokenFile and returns it together with
+// the fingerprint it was written with. The response body is restored, but the token
+// has no ProviderClient.
+func ReadTokenFile(path string) (*Token, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, "", fmt.Errorf("failed to parse token file %s: %w", path, err)
+	}
+	id, _ := body["token_id"].(string)
+	expiresAt, _ := body["expires_at"].(string)
+	if id == "" || expiresAt == "" {
+		return nil, "", fmt.Errorf("token file %s does not contain token_id and expires_at", path)
+	}
+	token := &Token{ID: id}
+	token.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse expires_at in token file %s: %w", path, err)
+	}
+	fingerprint, _ := body["auth_fingerprint"].(string)
+	delete(body, "auth_fingerprint")
+	token.Result.Body = body
+	return token, fingerprint, nil
+}
+
+// WriteTokenFile atomically writes the token in the format of JSONFormatter to a
+// file only readable by the user. The fingerprint, if not empty, is stored as
+// auth_fingerprint, so that readers can check that the token was issued for the
+// credentials and scope they expect.
+func WriteTokenFile(path string, token *Token, fingerprint string) error {
+	body, ok := token.Result.Body.(map[string]interface{})
+	if !ok {
+		return errors.New("token response body is not available")
+	}
+	//JSONFormatter adds its fields to the body, work on a copy
+	fileBody := make(map[string]interface{}, len(body)+1)
+	for key, value := range body {
+		fileBody[key] = value
+	}
+	if fingerprint != "" {
+		fileBody["auth_fingerprint"] = fingerprint
+	}
+	fileToken := *token
+	fileToken.Result.Body = fileBody
+
+	var buf bytes.Buffer
+	if err := (JSONFormatter{}).Format(&buf, &fileToken); err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it, so
+// that readers never see a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,168 @@
+package tokentool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Transport holds the TLS, timeout, retry and debug settings of all HTTP requests
+// to keystone and the other OpenStack services.
+type Transport struct {
+	//Cert is the client certificate for 2FA (PEM or PKCS#12 bundle). Key is optional
+	//if Cert contains the key.
+	Cert          string
+	Key           string
+	CACert        string
+	Insecure      bool
+	MinTLSVersion string
+	ServerName    string
+	//ExpiryWarning is the window before the expiry of Cert in which a warning is logged.
+	ExpiryWarning time.Duration
+	//CertPassphrase returns the passphrase for the encrypted key or PKCS#12 bundle at
+	//path. Encrypted keys and bundles cannot be loaded if it is nil.
+	CertPassphrase func(path string) (string, error)
+
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	Retries        int
+
+	//Debug traces all requests on stderr, HARFile records them into a HAR file.
+	Debug   bool
+	HARFile string
+}
+
+// HasClientCert reports whether a client certificate for 2FA is configured. The key
+// is optional because it can also be contained in the certificate file or bundle.
+func (t Transport) HasClientCert() bool {
+	return t.Cert != ""
+}
+
+// TLSConfig builds the TLS client configuration from the given settings.
+func (t Transport) TLSConfig() (*tls.Config, error) {
+	minVersion := uint16(tls.VersionTLS12)
+	if t.MinTLSVersion != "" {
+		v, ok := tlsVersions[t.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minimum TLS version %q, expected one of 1.0, 1.1, 1.2, 1.3", t.MinTLSVersion)
+		}
+		minVersion = v
+	}
+
+	config := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.Insecure,
+	}
+
+	if t.HasClientCert() {
+		cert, err := LoadClientCertificate(t.Cert, t.Key, t.CertPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		if err := CheckCertificateValidity(t.Cert, cert.Leaf, t.ExpiryWarning); err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.CACert != "" {
+		pem, err := os.ReadFile(t.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in CA bundle %s", t.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// HTTPClient builds the HTTP client used for all requests to keystone and the other
+// OpenStack services. The transport honours $HTTPS_PROXY/$NO_PROXY, applies the
+// configured timeouts and retries failed requests.
+func (t Transport) HTTPClient() (*http.Client, error) {
+	if t.Insecure {
+		log.Println("WARNING: TLS certificate verification is disabled (--insecure). Connections can be intercepted and your credentials stolen!")
+	}
+	tlsConfig, err := t.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   t.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   t.ConnectTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if t.Debug || t.HARFile != "" {
+		debug := &debugTransport{next: transport, debug: t.Debug}
+		if t.HARFile != "" {
+			debug.har = getHARRecorder(t.HARFile)
+		}
+		roundTripper = debug
+	}
+
+	return &http.Client{
+		Transport: newRetryTransport(roundTripper, t.Retries),
+		Timeout:   t.Timeout,
+	}, nil
+}
+
+// Inject replaces the HTTP client of provider with the one built by HTTPClient.
+func (t Transport) Inject(provider *gophercloud.ProviderClient) error {
+	client, err := t.HTTPClient()
+	if err != nil {
+		return err
+	}
+	provider.HTTPClient = *client
+	return nil
+}
+
+// CurlArgs returns the curl arguments matching the server verification and connect
+// timeout settings.
+func (t Transport) CurlArgs() []string {
+	var args []string
+	if t.CACert != "" {
+		args = append(args, "--cacert", t.CACert)
+	}
+	if t.Insecure {
+		args = append(args, "--insecure")
+	}
+	if t.MinTLSVersion != "" {
+		args = append(args, "--tlsv"+t.MinTLSVersion)
+	}
+	if t.ConnectTimeout > 0 {
+		args = append(args, "--connect-timeout", strconv.FormatFloat(t.ConnectTimeout.Seconds(), 'f', -1, 64))
+	}
+	return args
+}
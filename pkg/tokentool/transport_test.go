@@ -0,0 +1,105 @@
+package tokentool
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeServerCA writes the certificate of a TLS test server as CA bundle.
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLSConfig(t *testing.T) {
+	config, err := Transport{}.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS12 || config.InsecureSkipVerify || config.RootCAs != nil || len(config.Certificates) != 0 {
+		t.Errorf("unexpected defaults: %+v", config)
+	}
+
+	config, err = Transport{MinTLSVersion: "1.3", ServerName: "keystone.internal", Insecure: true}.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS13 || config.ServerName != "keystone.internal" || !config.InsecureSkipVerify {
+		t.Errorf("settings were not applied: %+v", config)
+	}
+
+	if _, err := (Transport{MinTLSVersion: "1.4"}).TLSConfig(); err == nil {
+		t.Error("expected an error for an unknown TLS version")
+	}
+
+	dir := t.TempDir()
+	noPEM := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(noPEM, []byte("no certificates here\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Transport{CACert: noPEM}).TLSConfig(); err == nil {
+		t.Error("expected an error for a CA bundle without certificates")
+	}
+	if _, err := (Transport{CACert: filepath.Join(dir, "missing.pem")}).TLSConfig(); err == nil {
+		t.Error("expected an error for a missing CA bundle")
+	}
+}
+
+func TestHTTPClientCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := Transport{Timeout: 5 * time.Second}.HTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(server.URL); ClassifyError(err) != KindTLS {
+		t.Errorf("got %v for an unknown CA, expected a TLS error", err)
+	}
+
+	client, err = Transport{Timeout: 5 * time.Second, CACert: writeServerCA(t, server)}.HTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d", resp.StatusCode)
+	}
+}
+
+func TestCurlArgs(t *testing.T) {
+	if args := (Transport{}).CurlArgs(); len(args) != 0 {
+		t.Errorf("got %q without settings", args)
+	}
+	args := Transport{
+		CACert:         "/etc/ssl/keystone.pem",
+		Insecure:       true,
+		MinTLSVersion:  "1.3",
+		ConnectTimeout: 1500 * time.Millisecond,
+		//not applicable to the service requests of curl
+		Cert:    "client.pem",
+		Timeout: time.Minute,
+	}.CurlArgs()
+	expected := []string{"--cacert", "/etc/ssl/keystone.pem", "--insecure", "--tlsv1.3", "--connect-timeout", "1.5"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("got %q, expected %q", args, expected)
+	}
+}